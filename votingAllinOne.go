@@ -20,10 +20,17 @@ under the License.
 package main
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
@@ -48,16 +55,844 @@ type  SimpleChaincode struct {
 //			  that element when reading a JSON object into the struct e.g. JSON make -> Struct Make.
 //==============================================================================================================================
 type Voter struct {
+	ObjectType					string `json:"docType"`        //docType is used to distinguish the various types of objects in state database
 	VID 						string `json:"VID"`
-	TokensBought    			string `json:"TokensBought"`
-	TokensRemaining				string `json:"TokensRemaining"`
-	Enabled						bool `json:"Enabled"`
+	ElectionID					string `json:"ElectionID"`
+	TokensBought    			uint64 `json:"TokensBought"`
+	TokensRemaining				uint64 `json:"TokensRemaining"`
+	Status						string `json:"Status"`           //see voterTransitions
+	StatusReason				string `json:"StatusReason"`     //reason code of the last status change
+	StatusChangedAt				string `json:"StatusChangedAt,omitempty"`
+	OwnerMSPID					string `json:"OwnerMSPID,omitempty"`   //identity that claimed this voter, empty until claimed
+	OwnerID						string `json:"OwnerID,omitempty"`
+	ClaimHash					string `json:"ClaimHash,omitempty"`    //hex sha256 of the claim secret, cleared once claimed
+	RemovalReason				string `json:"RemovalReason,omitempty"`  //set by remove_voter, the record stays as a tombstone
+	RemovedAt					string `json:"RemovedAt,omitempty"`
+	RemovedByMSPID				string `json:"RemovedByMSPID,omitempty"`
+	RemovedByID					string `json:"RemovedByID,omitempty"`
 }
 
 type Candidate struct {
+	ObjectType			string `json:"docType"`
 	CID 				string `json:"CID"`
+	ElectionID			string `json:"ElectionID"`
 	CandidateName    string `json:"CandidateName"`
-	VotesReceived    string `json:"VotesReceived"`
+	VotesReceived    uint64 `json:"VotesReceived"`
+	Status 				string `json:"Status,omitempty"`             //active when empty, see withdraw_candidate
+	Withdrawal 			string `json:"Withdrawal,omitempty"`         //policy applied when the candidate withdrew
+	WithdrawalReason 	string `json:"WithdrawalReason,omitempty"`
+	WithdrawnAt 		string `json:"WithdrawnAt,omitempty"`
+	WithdrawnByMSPID 	string `json:"WithdrawnByMSPID,omitempty"`
+	WithdrawnByID 		string `json:"WithdrawnByID,omitempty"`
+}
+
+// voter statuses
+const (
+	VoterActive    = "active"                 //can vote
+	VoterExhausted = "exhausted"              //has no tokens left, becomes active again when tokens come back
+	VoterSuspended = "suspended"              //stopped by an admin until reinstated
+	VoterRemoved   = "removed"                //final, kept as a tombstone that only auditors can read
+)
+
+// legal voter status changes, from -> to
+var voterTransitions = map[string][]string{
+	VoterActive:    {VoterExhausted, VoterSuspended, VoterRemoved},
+	VoterExhausted: {VoterActive, VoterSuspended, VoterRemoved},
+	VoterSuspended: {VoterActive, VoterExhausted, VoterRemoved},
+	VoterRemoved:   {},
+}
+
+// reason codes of voter status changes. The first three are set by the chaincode itself,
+// the others are what admins can give to suspend_voter and reinstate_voter.
+const (
+	ReasonRegistered     = "registered"
+	ReasonTokensSpent    = "tokens_spent"
+	ReasonTokensReturned = "tokens_returned"
+	ReasonIneligible     = "ineligible"
+	ReasonDuplicate      = "duplicate"
+	ReasonFraud          = "fraud"
+	ReasonAppeal         = "appeal"
+	ReasonError          = "error"
+	ReasonAdministrative = "administrative"
+)
+
+var adminReasons = []string{ReasonIneligible, ReasonDuplicate, ReasonFraud, ReasonAppeal, ReasonError, ReasonAdministrative}
+
+//==============================================================================================================================
+//	UnmarshalJSON - counts used to be stored as strings ("100"). Both the old and the numeric format are accepted,
+//					anything that does not parse as an unsigned number is an error rather than a silent zero.
+//					Voters stored before statuses existed only had an Enabled flag, which was cleared when they ran
+//					out of tokens.
+//==============================================================================================================================
+func (voter *Voter) UnmarshalJSON(data []byte) error {
+	type plainVoter Voter
+	var raw struct {
+		plainVoter
+		TokensBought    json.RawMessage `json:"TokensBought"`
+		TokensRemaining json.RawMessage `json:"TokensRemaining"`
+		Enabled         *bool `json:"Enabled"`
+	}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	*voter = Voter(raw.plainVoter)
+	voter.TokensBought, err = decode_count("TokensBought", raw.TokensBought)
+	if err != nil {
+		return err
+	}
+	voter.TokensRemaining, err = decode_count("TokensRemaining", raw.TokensRemaining)
+	if err != nil {
+		return err
+	}
+
+	if voter.Status == "" {
+		if raw.Enabled == nil {
+			return errors.New("Status is missing")
+		}
+		voter.Status = VoterActive
+		voter.StatusReason = ReasonRegistered
+		if !*raw.Enabled {
+			voter.Status = VoterExhausted
+			voter.StatusReason = ReasonTokensSpent
+		}
+	}
+	if _, known := voterTransitions[voter.Status]; !known {
+		return errors.New("Status is not a valid voter status - " + voter.Status)
+	}
+	return nil
+}
+
+func (candidate *Candidate) UnmarshalJSON(data []byte) error {
+	type plainCandidate Candidate
+	var raw struct {
+		plainCandidate
+		VotesReceived json.RawMessage `json:"VotesReceived"`
+	}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	*candidate = Candidate(raw.plainCandidate)
+	candidate.VotesReceived, err = decode_count("VotesReceived", raw.VotesReceived)
+	return err
+}
+
+//==============================================================================================================================
+//	Question - a motion of an election, answered by picking one of its fixed options. Voters weigh their answer with
+//			   tokens just like a vote for a candidate, Tallies hold the tokens each option received.
+//==============================================================================================================================
+type Question struct {
+	ObjectType 			string `json:"docType"`
+	QID 				string `json:"QID"`
+	ElectionID 			string `json:"ElectionID"`
+	Text 				string `json:"Text"`
+	Quorum 				uint64 `json:"Quorum"`            //percentage of eligible voters that must answer, 0 for none
+	Tallies 			[]OptionTally `json:"Tallies"`
+	Voters 				uint64 `json:"Voters"`            //voters who answered
+}
+
+type OptionTally struct {
+	Option 				string `json:"Option"`
+	Votes 				uint64 `json:"Votes"`
+}
+
+//==============================================================================================================================
+//	Answer - the answer of one voter to a question. A voter answers each question once.
+//==============================================================================================================================
+type Answer struct {
+	ObjectType 			string `json:"docType"`
+	AnswerID 			string `json:"AnswerID"`          //id of the transaction that answered
+	ElectionID 			string `json:"ElectionID"`
+	QID 				string `json:"QID"`
+	VID 				string `json:"VID"`
+	Option 				string `json:"Option"`
+	Tokens 				uint64 `json:"Tokens"`
+	AnsweredAt 			string `json:"AnsweredAt"`
+}
+
+//==============================================================================================================================
+//	Election - Defines the structure for an election object. An election walks through the statuses
+//			  draft -> open -> closed -> finalized, and can be archived once closed. Times are taken from the
+//			  transaction timestamp.
+//==============================================================================================================================
+type Election struct {
+	ObjectType 			string `json:"docType"`
+	EID 				string `json:"EID"`
+	Title 				string `json:"Title"`
+	Status 				string `json:"Status"`
+	CreatedAt 			string `json:"CreatedAt"`
+	OpenedAt 			string `json:"OpenedAt,omitempty"`
+	ClosedAt 			string `json:"ClosedAt,omitempty"`
+	FinalizedAt 		string `json:"FinalizedAt,omitempty"`
+	ArchivedAt 			string `json:"ArchivedAt,omitempty"`
+	ArchivedByMSPID 	string `json:"ArchivedByMSPID,omitempty"`
+	ArchivedByID 		string `json:"ArchivedByID,omitempty"`
+	BallotMode 			string `json:"BallotMode"`
+	UnrevealedPolicy 	string `json:"UnrevealedPolicy,omitempty"`
+	AllowRevocation 	bool `json:"AllowRevocation"`
+	MaxTokens 			uint64 `json:"MaxTokens"`         //most tokens a voter can buy in total, DefaultMaxTokens when 0
+	Withdrawal 			string `json:"Withdrawal,omitempty"` //what withdraw_candidate does with votes, block when empty
+	VoteCost 			string `json:"VoteCost,omitempty"` //how many tokens a vote costs, linear when empty
+	Method 				string `json:"Method,omitempty"`   //how ballots are expressed and counted, tokens when empty
+	Seats 				uint64 `json:"Seats,omitempty"`    //stv only, number of candidates elected
+	Quota 				string `json:"Quota,omitempty"`    //stv only, droop or hare
+}
+
+//==============================================================================================================================
+//	Commitment - a sealed vote of a commit_reveal election. The voter's tokens are escrowed when the hash of
+//				 (candidate id, tokens, nonce) is committed and only reach the candidate once the vote is revealed.
+//==============================================================================================================================
+type Commitment struct {
+	ObjectType 			string `json:"docType"`
+	CommitID 			string `json:"CommitID"`          //id of the commit_vote transaction
+	ElectionID 			string `json:"ElectionID"`
+	VID 				string `json:"VID"`
+	Hash 				string `json:"Hash"`
+	Tokens 				uint64 `json:"Tokens"`
+	Status 				string `json:"Status"`
+	CID 				string `json:"CID,omitempty"`     //set once revealed
+	CommittedAt 		string `json:"CommittedAt"`
+	SettledAt 			string `json:"SettledAt,omitempty"`
+}
+
+//==============================================================================================================================
+//	Receipt - one purchase of tokens by a voter, written by init_voter for the first purchase and by buy_tokens
+//==============================================================================================================================
+type Receipt struct {
+	ObjectType 			string `json:"docType"`
+	ReceiptID 			string `json:"ReceiptID"`         //id of the purchasing transaction
+	ElectionID 			string `json:"ElectionID"`
+	VID 				string `json:"VID"`
+	Tokens 				uint64 `json:"Tokens"`
+	TokensBought 		uint64 `json:"TokensBought"`      //voter's total after this purchase
+	BuyerMSPID 			string `json:"BuyerMSPID"`
+	BuyerID 			string `json:"BuyerID"`
+	PurchasedAt 		string `json:"PurchasedAt"`
+}
+
+//==============================================================================================================================
+//	Ballot - an immutable record of one vote, written by the transaction that moved the tokens. Private votes
+//			 have no Ballot, their record is the PrivateVote in the collection.
+//==============================================================================================================================
+type Ballot struct {
+	ObjectType 			string `json:"docType"`
+	BallotID 			string `json:"BallotID"`          //id of the transaction that cast the vote
+	ElectionID 			string `json:"ElectionID"`
+	VID 				string `json:"VID"`
+	CID 				string `json:"CID"`
+	Tokens 				uint64 `json:"Tokens"`            //tokens spent
+	Votes 				uint64 `json:"Votes"`             //effective votes the candidate received, equal to Tokens unless quadratic
+	Delegator 			string `json:"Delegator,omitempty"` //voter whose delegated tokens were spent, VID is the delegate
+	CastAt 				string `json:"CastAt"`
+	Revoked 			bool `json:"Revoked"`           //a revoked ballot no longer counts, see revoke_vote
+	RevokedAt 			string `json:"RevokedAt,omitempty"`
+	RevokedBy 			string `json:"RevokedBy,omitempty"` //id of the revoke_vote transaction
+}
+
+//==============================================================================================================================
+//	Delegation - tokens a voter handed to another voter of the same election. They are escrowed away from the delegator
+//				 and the delegate spends them with transfer_vote on the delegator's behalf. The topic is the candidate
+//				 the tokens may go to, "*" for any candidate. A delegate can pass the tokens on by delegating the same
+//				 topic, whoever ends the chain spends them.
+//==============================================================================================================================
+type Delegation struct {
+	ObjectType 			string `json:"docType"`
+	ElectionID 			string `json:"ElectionID"`
+	Delegator 			string `json:"Delegator"`
+	Delegate 			string `json:"Delegate"`
+	Topic 				string `json:"Topic"`
+	Tokens 				uint64 `json:"Tokens"`            //escrowed tokens not spent yet
+	TokensDelegated 	uint64 `json:"TokensDelegated"`   //tokens escrowed in total
+	TokensSpent 		uint64 `json:"TokensSpent"`
+	CreatedAt 			string `json:"CreatedAt"`
+}
+
+//==============================================================================================================================
+//	Allocation - the effective votes a voter has given a candidate of a quadratic election and the tokens they cost.
+//				 Giving v votes costs v*v tokens in total, so the price of one more vote grows with every vote.
+//==============================================================================================================================
+type Allocation struct {
+	ObjectType 			string `json:"docType"`
+	ElectionID 			string `json:"ElectionID"`
+	VID 				string `json:"VID"`
+	CID 				string `json:"CID"`
+	Votes 				uint64 `json:"Votes"`
+	TokensSpent 		uint64 `json:"TokensSpent"`
+}
+
+//==============================================================================================================================
+//	Ranked Ballot - the preferences of one voter in a ranked election, most preferred candidate first. Each voter casts
+//					a single ranked ballot, tokens play no part in it.
+//==============================================================================================================================
+type RankedBallot struct {
+	ObjectType 			string `json:"docType"`
+	BallotID 			string `json:"BallotID"`          //id of the transaction that cast the ballot
+	ElectionID 			string `json:"ElectionID"`
+	VID 				string `json:"VID"`
+	Rankings 			[]string `json:"Rankings"`
+	CastAt 				string `json:"CastAt"`
+}
+
+//==============================================================================================================================
+//	Marked Ballot - the ballot of an approval or score election. Each mark gives a candidate a value, 1 for an approval
+//					or the 0 to MaxScore score. Candidates without a mark get nothing. Each voter casts a single ballot.
+//==============================================================================================================================
+type Mark struct {
+	CID 				string `json:"CID"`
+	Value 				uint64 `json:"Value"`
+}
+
+type MarkedBallot struct {
+	ObjectType 			string `json:"docType"`
+	BallotID 			string `json:"BallotID"`          //id of the transaction that cast the ballot
+	ElectionID 			string `json:"ElectionID"`
+	VID 				string `json:"VID"`
+	Method 				string `json:"Method"`
+	Marks 				[]Mark `json:"Marks"`
+	CastAt 				string `json:"CastAt"`
+}
+
+//==============================================================================================================================
+//	Ballot Type - how the ballots of a voting method are cast and counted. cast_ballot and tally_ballots look the
+//				  election's method up in ballotTypes, a new method only needs an entry there.
+//==============================================================================================================================
+type BallotType interface {
+	Cast(stub shim.ChaincodeStubInterface, args []string) pb.Response      //args are those of cast_ballot
+	Tally(stub shim.ChaincodeStubInterface, args []string) pb.Response     //args are those of tally_ballots
+}
+
+// entryPoints is the ballot type of methods that have their own cast and tally functions
+type entryPoints struct {
+	cast  func(shim.ChaincodeStubInterface, []string) pb.Response
+	tally func(shim.ChaincodeStubInterface, []string) pb.Response
+}
+
+// markBallots is the ballot type of methods storing a MarkedBallot, parse validates the ballot content
+type markBallots struct {
+	method string
+	parse  func(content []string) ([]Mark, error)
+}
+
+// notFoundError is returned by the get_ functions when nothing is stored under the key. Any other error means the
+// state is there but could not be read or decoded, and must not be overwritten.
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+var ballotTypes = map[string]BallotType{
+	MethodTokens:   entryPoints{cast: transfer_vote, tally: get_results},
+	MethodIRV:      entryPoints{cast: cast_ranked_ballot, tally: tally_irv},
+	MethodSTV:      entryPoints{cast: cast_ranked_ballot, tally: tally_stv},
+	MethodApproval: markBallots{method: MethodApproval, parse: parse_approval},
+	MethodScore:    markBallots{method: MethodScore, parse: parse_score},
+}
+
+//==============================================================================================================================
+//	Private Vote - the voter to candidate allocation of a private election. It lives in the PrivateCollection,
+//				   the channel only sees a BallotHash of it. Candidate totals are published when the election closes.
+//==============================================================================================================================
+type PrivateVote struct {
+	ObjectType 			string `json:"docType"`
+	BallotID 			string `json:"BallotID"`          //id of the cast_private_vote transaction
+	ElectionID 			string `json:"ElectionID"`
+	VID 				string `json:"VID"`
+	CID 				string `json:"CID"`
+	Tokens 				uint64 `json:"Tokens"`
+	Salt 				string `json:"Salt"`              //chosen by the voter so the hash can't be guessed
+}
+
+type BallotHash struct {
+	ObjectType 			string `json:"docType"`
+	BallotID 			string `json:"BallotID"`
+	ElectionID 			string `json:"ElectionID"`
+	VID 				string `json:"VID"`
+	Hash 				string `json:"Hash"`              //hex sha256 of the stored PrivateVote JSON
+	CastAt 				string `json:"CastAt"`
+}
+
+// private data collection holding PrivateVote, see collections_config.json
+const PrivateCollection = "collectionBallots"
+
+// transient map key carrying the secret that claim_voter checks against the voter's ClaimHash
+const ClaimSecretKey = "secret"
+
+// transient map key carrying the private ballot {"CID":"c001","Tokens":20,"Salt":"..."}
+const PrivateBallotKey = "ballot"
+
+// object types - used both as the composite key namespace and as the docType of the stored JSON
+const (
+	VoterObject     = "voter"
+	CandidateObject = "candidate"
+	ElectionObject  = "election"
+	CommitmentObject = "commitment"
+	PrivateVoteObject = "private_vote"
+	BallotHashObject = "ballot_hash"
+	BallotObject = "ballot"
+	ReceiptObject = "receipt"
+	AllocationObject = "allocation"
+	RankedBallotObject = "ranked_ballot"
+	MarkedBallotObject = "marked_ballot"
+	QuestionObject = "question"
+	AnswerObject = "answer"
+	DelegationObject = "delegation"
+)
+
+// index keys - composite keys pointing back at an asset
+const (
+	OwnerIndex = "owner~voter"
+	VoterBallotIndex = "voter~ballot"
+	CandidateBallotIndex = "candidate~ballot"
+	DelegateIndex = "delegate~delegation"
+)
+
+// topic of a delegation valid for any candidate, used when the delegator has no delegation for the candidate itself
+const AnyTopic = "*"
+
+// most delegations a chain can go through, tokens further away cannot be spent
+const MaxDelegationDepth = 3
+
+// most tokens a voter can buy in an election created without max_tokens
+const DefaultMaxTokens = 1000
+
+// election statuses
+const (
+	ElectionDraft     = "draft"
+	ElectionOpen      = "open"
+	ElectionClosed    = "closed"
+	ElectionFinalized = "finalized"
+	ElectionArchived  = "archived"            //read only, no function writes to an archived election
+)
+
+// ballot modes - public votes count immediately, commit_reveal votes are sealed until the election closes,
+// private votes keep the allocation in a private data collection
+const (
+	BallotPublic       = "public"
+	BallotCommitReveal = "commit_reveal"
+	BallotPrivate      = "private"
+)
+
+// what finalize_election does with tokens escrowed by commitments that were never revealed
+const (
+	UnrevealedRefund  = "refund"
+	UnrevealedForfeit = "forfeit"
+)
+
+// vote cost functions - linear votes cost one token each, quadratic votes cost the square of the votes given a candidate
+const (
+	VoteCostLinear    = "linear"
+	VoteCostQuadratic = "quadratic"
+)
+
+// voting methods - tokens are transferred to candidates, irv and stv voters rank the candidates. irv elects a single
+// candidate by instant runoff, stv fills several seats by single transferable vote. approval voters approve any number
+// of candidates, score voters give candidates 0 to MaxScore, the highest total wins
+const (
+	MethodTokens   = "tokens"
+	MethodIRV      = "irv"
+	MethodSTV      = "stv"
+	MethodApproval = "approval"
+	MethodScore    = "score"
+)
+
+// discrepancy kinds reported by verify_invariants
+const (
+	DiscrepancyUndecodable     = "undecodable"       //a record that does not parse
+	DiscrepancyNegativeBalance = "negative_balance"  //a voter with more tokens remaining than bought
+	DiscrepancyOverspent       = "overspent"         //a voter whose records account for more tokens than it paid
+	DiscrepancyUnaccounted     = "unaccounted"       //a voter that paid tokens no record accounts for
+	DiscrepancyStatus          = "status_mismatch"   //an active voter without tokens or an exhausted one with tokens
+	DiscrepancyOrphaned        = "orphaned"          //a record pointing at a voter or candidate that does not exist
+	DiscrepancyTally           = "tally_mismatch"    //a candidate whose votes differ from its ballots
+	DiscrepancyQuestion        = "question_mismatch" //a question whose tallies differ from its answers
+	DiscrepancyDanglingIndex   = "dangling_index"    //an index entry without its ballot
+	DiscrepancyOverflow        = "overflow"          //a total too large to count
+)
+
+// version of the ChaincodeEvent payloads
+const EventVersion = 1
+
+// event types and the Data they carry
+const (
+	EventElectionCreated       = "ElectionCreated"       //Election
+	EventElectionStatusChanged = "ElectionStatusChanged" //Election
+	EventStateMigrated         = "StateMigrated"         //migration report
+	EventVoterCreated          = "VoterCreated"          //Voter
+	EventVoterClaimed          = "VoterClaimed"          //Voter
+	EventClaimIssued           = "ClaimIssued"           //Voter
+	EventVoterStatusChanged    = "VoterStatusChanged"    //Voter
+	EventVoterRemoved          = "VoterRemoved"          //Voter
+	EventTokensBought          = "TokensBought"          //Voter
+	EventCandidateCreated      = "CandidateCreated"      //Candidate
+	EventCandidateRemoved      = "CandidateRemoved"      //Candidate
+	EventQuestionCreated       = "QuestionCreated"       //Question
+	EventQuestionAnswered      = "QuestionAnswered"      //Answer
+	EventVoteCast              = "VoteCast"              //VoteEvent
+	EventVoteRevoked           = "VoteRevoked"           //VoteEvent
+	EventVoteCommitted         = "VoteCommitted"         //Commitment
+	EventVoteRevealed          = "VoteRevealed"          //VoteEvent
+	EventPrivateVoteCast       = "PrivateVoteCast"       //BallotHash
+	EventBallotCast            = "BallotCast"            //RankedBallot or MarkedBallot
+	EventTokensDelegated       = "TokensDelegated"       //Delegation
+	EventDelegationRevoked     = "DelegationRevoked"     //Delegation
+)
+
+// highest score a score ballot can give a candidate
+const MaxScore = 10
+
+// options of a question created without any, answers for AbstainOption count towards turnout but never win
+var DefaultOptions = []string{"yes", "no", AbstainOption}
+const AbstainOption = "abstain"
+
+// stv quotas - droop is floor(ballots / (seats + 1)) + 1, hare is ballots / seats
+const (
+	QuotaDroop = "droop"
+	QuotaHare  = "hare"
+)
+
+// stv vote values are fixed point with this many units per ballot so every peer computes the same transfers
+const STVScale = 100000
+
+// candidate statuses - a withdrawn candidate stays on the ledger as a tombstone and takes no more votes
+const (
+	CandidateActive    = "active"
+	CandidateWithdrawn = "withdrawn"
+)
+
+// withdrawal policies - refund gives the voters their tokens back, freeze keeps the votes on record but out of the
+// running, block only lets candidates withdraw before the election opens
+const (
+	WithdrawalRefund = "refund"
+	WithdrawalFreeze = "freeze"
+	WithdrawalBlock  = "block"
+)
+
+// commitment statuses
+const (
+	CommitmentSealed    = "sealed"
+	CommitmentRevealed  = "revealed"
+	CommitmentRefunded  = "refunded"
+	CommitmentForfeited = "forfeited"
+)
+
+//==============================================================================================================================
+//	Cost Preview - Defines the structure returned by preview_vote_cost
+//==============================================================================================================================
+type CostPreview struct {
+	ElectionID 			string `json:"ElectionID"`
+	VID 				string `json:"VID"`
+	CID 				string `json:"CID"`
+	VoteCost 			string `json:"VoteCost"`
+	CurrentVotes 		uint64 `json:"CurrentVotes"`
+	TokensSpent 		uint64 `json:"TokensSpent"`
+	AdditionalVotes 	uint64 `json:"AdditionalVotes"`
+	Cost 				uint64 `json:"Cost"`
+	TokensRemaining 	uint64 `json:"TokensRemaining"`
+	Affordable 			bool `json:"Affordable"`
+}
+
+//==============================================================================================================================
+//	IRV Results - Defines the structure returned by tally_irv. Every round lists the continuing candidates with the
+//				  ballots counting for them, the ballots that ran out of continuing preferences and what the round decided.
+//==============================================================================================================================
+type RoundTally struct {
+	CID 				string `json:"CID"`
+	Votes 				uint64 `json:"Votes"`
+}
+
+type IRVRound struct {
+	Round 				int `json:"Round"`
+	Tallies 			[]RoundTally `json:"Tallies"`
+	Exhausted 			uint64 `json:"Exhausted"`
+	Elected 			string `json:"Elected,omitempty"`
+	Eliminated 			string `json:"Eliminated,omitempty"`
+	TieBreak 			bool `json:"TieBreak"`           //the eliminated candidate was picked among several with the fewest votes
+}
+
+type IRVResults struct {
+	ElectionID 			string `json:"ElectionID"`
+	Status 				string `json:"Status"`
+	Ballots 			uint64 `json:"Ballots"`
+	Rounds 				[]IRVRound `json:"Rounds"`
+	Winner 				string `json:"Winner"`
+}
+
+//==============================================================================================================================
+//	STV Results - Defines the structure returned by tally_stv. Tallies, quota, surplus and exhausted votes are fixed point
+//				  values in units of 1/Scale of a ballot. A round either elects the leading candidate, transferring each of
+//				  their ballots at its weight times Surplus/Votes (rounded down), or eliminates the last one, whose ballots
+//				  move on at full weight. The last round may elect every continuing candidate once they fill the seats left.
+//==============================================================================================================================
+type STVRound struct {
+	Round 				int `json:"Round"`
+	Tallies 			[]RoundTally `json:"Tallies"`
+	Exhausted 			uint64 `json:"Exhausted"`
+	Elected 			[]string `json:"Elected,omitempty"`
+	Surplus 			uint64 `json:"Surplus,omitempty"`
+	Eliminated 			string `json:"Eliminated,omitempty"`
+	TieBreak 			bool `json:"TieBreak"`
+}
+
+type STVResults struct {
+	ElectionID 			string `json:"ElectionID"`
+	Status 				string `json:"Status"`
+	Seats 				uint64 `json:"Seats"`
+	QuotaMethod 		string `json:"QuotaMethod"`
+	Quota 				uint64 `json:"Quota"`
+	Scale 				uint64 `json:"Scale"`
+	Ballots 			uint64 `json:"Ballots"`
+	Rounds 				[]STVRound `json:"Rounds"`
+	Elected 			[]string `json:"Elected"`
+}
+
+//==============================================================================================================================
+//	Mark Results - Defines the structure returned by tally_ballots for approval and score elections. Total is the sum
+//				   of the candidate's marks, Marks the number of ballots marking the candidate.
+//==============================================================================================================================
+type MarkTally struct {
+	CID 				string `json:"CID"`
+	CandidateName    	string `json:"CandidateName"`
+	Total 				uint64 `json:"Total"`
+	Marks 				uint64 `json:"Marks"`
+}
+
+type MarkResults struct {
+	ElectionID 			string `json:"ElectionID"`
+	Status 				string `json:"Status"`
+	Method 				string `json:"Method"`
+	Ballots 			uint64 `json:"Ballots"`
+	Candidates 			[]MarkTally `json:"Candidates"`
+	Winners 			[]string `json:"Winners"`
+	Tie 				bool `json:"Tie"`
+}
+
+//==============================================================================================================================
+//	Delegations - Defines the structure returned by read_delegations
+//==============================================================================================================================
+type Delegations struct {
+	Given 				[]Delegation `json:"Given"`
+	Received 			[]Delegation `json:"Received"`
+}
+
+//==============================================================================================================================
+//	Chaincode Event - the payload of the event every state changing function sets, named after Type. Data holds the
+//					  asset the transaction wrote, for votes a VoteEvent. Version changes when a payload changes shape.
+//==============================================================================================================================
+type ChaincodeEvent struct {
+	Type 				string `json:"Type"`
+	Version 			int `json:"Version"`
+	ElectionID 			string `json:"ElectionID"`
+	TxID 				string `json:"TxID"`
+	Timestamp 			string `json:"Timestamp"`
+	Data 				interface{} `json:"Data"`
+}
+
+// VoteEvent is the Data of VoteCast, VoteRevealed and VoteRevoked, the candidate holds its new total
+type VoteEvent struct {
+	Ballot 				Ballot `json:"Ballot"`
+	Candidate 			Candidate `json:"Candidate"`
+}
+
+//==============================================================================================================================
+//	Invariant Report - Defines the structure returned by verify_invariants. TokensSpent is what voters paid
+//					   (TokensBought - TokensRemaining), TokensAccounted what ballots, escrows, forfeits and answers
+//					   explain. VotesReceived sums the candidates, BallotVotes the ballots that were not revoked.
+//==============================================================================================================================
+type Discrepancy struct {
+	Kind 				string `json:"Kind"`
+	ID 					string `json:"ID"`
+	Detail 				string `json:"Detail"`
+}
+
+type InvariantReport struct {
+	ElectionID 			string `json:"ElectionID"`
+	Voters 				uint64 `json:"Voters"`
+	Candidates 			uint64 `json:"Candidates"`
+	Ballots 			uint64 `json:"Ballots"`
+	TokensBought 		uint64 `json:"TokensBought"`
+	TokensRemaining 	uint64 `json:"TokensRemaining"`
+	TokensSpent 		uint64 `json:"TokensSpent"`
+	TokensAccounted 	uint64 `json:"TokensAccounted"`
+	VotesReceived 		uint64 `json:"VotesReceived"`
+	BallotVotes 		uint64 `json:"BallotVotes"`
+	Discrepancies 		[]Discrepancy `json:"Discrepancies"`
+	Notes 				[]string `json:"Notes"`
+	Valid 				bool `json:"Valid"`
+}
+
+//==============================================================================================================================
+//	Results - Defines the structure returned by get_results. Candidates are sorted by votes received, highest first.
+//==============================================================================================================================
+type CandidateResult struct {
+	CID 				string `json:"CID"`
+	CandidateName    	string `json:"CandidateName"`
+	VotesReceived    	uint64 `json:"VotesReceived"`
+	Percentage    		float64 `json:"Percentage"`
+	Withdrawn 			bool `json:"Withdrawn"`          //frozen votes of a withdrawn candidate count in the total but cannot win
+}
+
+type ElectionResults struct {
+	ElectionID 			string `json:"ElectionID"`
+	Status 				string `json:"Status"`
+	TotalVotes 			uint64 `json:"TotalVotes"`
+	Candidates 			[]CandidateResult `json:"Candidates"`
+	Winners 			[]string `json:"Winners"`
+	Tie 				bool `json:"Tie"`
+}
+
+//==============================================================================================================================
+//	Question Results - Defines the structure returned by get_question_results. Turnout is the percentage of eligible
+//					   voters (active or exhausted) who answered, the question passes its quorum when it reaches Quorum.
+//==============================================================================================================================
+type OptionResult struct {
+	Option 				string `json:"Option"`
+	Votes 				uint64 `json:"Votes"`
+	Percentage    		float64 `json:"Percentage"`
+}
+
+type QuestionResults struct {
+	ElectionID 			string `json:"ElectionID"`
+	QID 				string `json:"QID"`
+	Text 				string `json:"Text"`
+	Status 				string `json:"Status"`
+	TotalVotes 			uint64 `json:"TotalVotes"`
+	Options 			[]OptionResult `json:"Options"`
+	Voters 				uint64 `json:"Voters"`            //voters who answered and are still eligible
+	EligibleVoters 		uint64 `json:"EligibleVoters"`
+	Turnout 			float64 `json:"Turnout"`
+	Quorum 				uint64 `json:"Quorum"`
+	QuorumMet 			bool `json:"QuorumMet"`
+	Winners 			[]string `json:"Winners"`
+	Tie 				bool `json:"Tie"`
+}
+
+//==============================================================================================================================
+//	Pages - Defines the structure returned by list_voters and list_candidates. Pass Bookmark back to get the next page,
+//			an empty Bookmark means there are no more records. Filters are applied after fetching, so a page can
+//			hold fewer Records than FetchedRecordsCount.
+//==============================================================================================================================
+type VoterPage struct {
+	Records 				[]Voter `json:"Records"`
+	FetchedRecordsCount 	int32 `json:"FetchedRecordsCount"`
+	Bookmark 				string `json:"Bookmark"`
+}
+
+type CandidatePage struct {
+	Records 				[]Candidate `json:"Records"`
+	FetchedRecordsCount 	int32 `json:"FetchedRecordsCount"`
+	Bookmark 				string `json:"Bookmark"`
+}
+
+//==============================================================================================================================
+//	History Entry - one modification of a key, as returned by get_voter_history and get_candidate_history.
+//					Value holds the decoded asset, it is empty when the modification was a delete.
+//==============================================================================================================================
+type HistoryEntry struct {
+	TxID 				string `json:"TxID"`
+	Timestamp 			string `json:"Timestamp"`
+	IsDelete 			bool `json:"IsDelete"`
+	Value 				interface{} `json:"Value"`
+	unixNano			int64       //full precision of Timestamp, for sorting
+}
+
+// largest page list_voters and list_candidates will return, bigger requests are capped
+const MaxPageSize = 100
+
+
+// ============================================================================================================================
+// Access Control - every function lists the roles allowed to call it. The role comes from the "role" attribute of
+// the caller's enrollment certificate (fabric-ca-client register --id.attrs 'role=admin:ecert').
+// ============================================================================================================================
+//==============================================================================================================================
+//	Identity - who submitted the transaction, as seen by the client identity library
+//==============================================================================================================================
+type Identity struct {
+	MSPID 				string `json:"MSPID"`
+	ID 					string `json:"ID"`
+	Role 				string `json:"Role"`
+}
+
+// roles
+const (
+	RoleAdmin     = "admin"
+	RoleRegistrar = "registrar"
+	RoleVoter     = "voter"
+	RoleAuditor   = "auditor"                 //read only, the only role that sees removed voters
+)
+
+// name of the certificate attribute holding the role
+const RoleAttribute = "role"
+
+// state key of the MSPs trusted for each role
+const RoleMSPsKey = "role_msps"
+
+// MSPs whose CAs are trusted to issue each role. A role attribute from any other organization on the channel is
+// ignored. Init stores the MSPs of a network under RoleMSPsKey, these are only used until it does.
+var defaultRoleMSPs = map[string][]string{
+	RoleAdmin:     {"Org1MSP"},
+	RoleRegistrar: {"Org1MSP"},
+	RoleVoter:     {"Org1MSP", "Org2MSP"},
+	RoleAuditor:   {"Org1MSP", "Org2MSP"},
+}
+
+// queries only, every function that writes lists its roles explicitly so the read only auditor never gets one
+var readRoles = []string{RoleAdmin, RoleRegistrar, RoleVoter, RoleAuditor}
+
+var accessControl = map[string][]string{
+	"init":              {RoleAdmin},
+	"create_election":   {RoleAdmin},
+	"open_election":     {RoleAdmin},
+	"close_election":    {RoleAdmin},
+	"finalize_election": {RoleAdmin},
+	"archive_election":  {RoleAdmin},
+	"read_election":     readRoles,
+	"init_voter":        {RoleAdmin, RoleRegistrar},
+	"read_voter":        readRoles,
+	"buy_tokens":        {RoleAdmin, RoleRegistrar},
+	"get_receipts":      readRoles,
+	"remove_voter":      {RoleAdmin},
+	"delete_voter":      {RoleAdmin},
+	"suspend_voter":     {RoleAdmin},
+	"reinstate_voter":   {RoleAdmin},
+	"list_voters":       {RoleAdmin, RoleRegistrar, RoleAuditor},
+	"init_candidate":    {RoleAdmin, RoleRegistrar},
+	"create_question":   {RoleAdmin, RoleRegistrar},
+	"answer_question":   {RoleVoter},
+	"read_question":     readRoles,
+	"get_question_results": readRoles,
+	"read_candidate":    readRoles,
+	"withdraw_candidate": {RoleAdmin},
+	"delete_candidate":  {RoleAdmin},
+	"list_candidates":   readRoles,
+	"claim_voter":       {RoleVoter},
+	"issue_claim":       {RoleAdmin, RoleRegistrar},
+	"commit_vote":       {RoleVoter},
+	"reveal_vote":       {RoleVoter},
+	"read_commitments":  readRoles,
+	"cast_private_vote": {RoleVoter},
+	"read_private_vote": {RoleVoter},
+	"get_ballots_by_voter":     readRoles,
+	"get_ballots_by_candidate": readRoles,
+	"get_voter_history":        readRoles,
+	"get_candidate_history":    readRoles,
+	"transfer_vote":     {RoleVoter},
+	"revoke_vote":       {RoleVoter},
+	"delegate_tokens":   {RoleVoter},
+	"revoke_delegation": {RoleVoter},
+	"read_delegations":  readRoles,
+	"preview_vote_cost": readRoles,
+	"cast_ranked_ballot": {RoleVoter},
+	"read_ranked_ballot": readRoles,
+	"tally_irv":         readRoles,
+	"tally_stv":         readRoles,
+	"cast_ballot":       {RoleVoter},
+	"tally_ballots":     readRoles,
+	"read_marked_ballot": readRoles,
+	"get_results":       readRoles,
+	"verify_invariants": readRoles,
+	"migrate_state":     {RoleAdmin},
 }
 
 
@@ -75,10 +910,11 @@ func main() {
 // ============================================================================================================================
 // Init - initialize the chaincode 
 //
-// VotingApp does not require initialization, so let's run a simple test instead.
+// VotingApp does not require initialization, so let's run a simple test instead. The optional "role=MSP,MSP" arguments
+// set the MSPs trusted to issue a role, roles left out keep the MSPs they had (defaultRoleMSPs at first).
 //
 // Inputs - Array of strings
-//  ["314"]
+//  ["314", "admin=Org1MSP", "voter=Org1MSP,Org2MSP"]
 // 
 // Returns - shim.Success or error
 // ============================================================================================================================
@@ -93,8 +929,8 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println("Init() args count:", len(args))
 	fmt.Println("Init() args found:", args)
 
-	// expecting 1 arg for instantiate or upgrade
-	if len(args) == 1 {
+	// expecting 1 arg for instantiate or upgrade, then the trusted MSPs
+	if len(args) >= 1 {
 		fmt.Println("Init() arg[0] length", len(args[0]))
 
 		// expecting arg[0] to be length 0 for upgrade
@@ -118,6 +954,23 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 		}
 	}
 
+	if len(args) > 1 {
+		roleMSPs, err := get_role_msps(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = parse_role_msps(roleMSPs, args[1:])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		roleMSPsAsBytes, _ := json.Marshal(roleMSPs)
+		err = stub.PutState(RoleMSPsKey, roleMSPsAsBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		fmt.Println("Trusted MSPs: " + string(roleMSPsAsBytes))
+	}
+
 	// store compaitible Voting application version
 	err = stub.PutState("voting_ui", []byte("4.0.0"))
 	if err != nil {
@@ -140,23 +993,118 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println(" ")
 	fmt.Println("starting invoke, for - " + function)
 
+	// make sure the caller holds one of the roles allowed to call this function
+	_, err := check_access(stub, function)
+	if err != nil {
+		fmt.Println(err.Error())
+		return shim.Error(err.Error())
+	}
+
 	// Handle different functions
 	if function == "init" {                    //initialize the chaincode state, used as reset
 		return t.Init(stub)
 	} else if function == "read_voter" {             
 		return read_voter(stub, args)
-	} else if function == "delete_voter" {    
-		return delete_voter(stub, args)
+	} else if function == "remove_voter" {
+		return remove_voter(stub, args)
+	} else if function == "delete_voter" {     //kept for older clients, voters are removed rather than deleted
+		return remove_voter(stub, args)
 	} else if function == "init_voter" {      
 		return init_voter(stub, args)
+	} else if function == "suspend_voter" {
+		return suspend_voter(stub, args)
+	} else if function == "reinstate_voter" {
+		return reinstate_voter(stub, args)
+	} else if function == "buy_tokens" {
+		return buy_tokens(stub, args)
+	} else if function == "get_receipts" {
+		return get_receipts(stub, args)
 	}else if function == "init_candidate" {      
 		return init_candidate(stub, args)
 	}else if function == "read_candidate" {      
 		return read_candidate(stub, args)
-	}else if function == "delete_candidate" {      
-		return delete_candidate(stub, args)
+	}else if function == "create_question" {
+		return create_question(stub, args)
+	}else if function == "answer_question" {
+		return answer_question(stub, args)
+	}else if function == "read_question" {
+		return read_question(stub, args)
+	}else if function == "get_question_results" {
+		return get_question_results(stub, args)
+	}else if function == "withdraw_candidate" {
+		return withdraw_candidate(stub, args)
+	}else if function == "delete_candidate" {      //kept for older clients, candidates are withdrawn rather than deleted
+		return withdraw_candidate(stub, args)
 	}else if function == "transfer_vote" {      
 		return transfer_vote(stub, args)
+	}else if function == "revoke_vote" {
+		return revoke_vote(stub, args)
+	}else if function == "delegate_tokens" {
+		return delegate_tokens(stub, args)
+	}else if function == "revoke_delegation" {
+		return revoke_delegation(stub, args)
+	}else if function == "read_delegations" {
+		return read_delegations(stub, args)
+	}else if function == "issue_claim" {
+		return issue_claim(stub, args)
+	}else if function == "claim_voter" {
+		return claim_voter(stub, args)
+	}else if function == "commit_vote" {
+		return commit_vote(stub, args)
+	}else if function == "reveal_vote" {
+		return reveal_vote(stub, args)
+	}else if function == "read_commitments" {
+		return read_commitments(stub, args)
+	}else if function == "cast_private_vote" {
+		return cast_private_vote(stub, args)
+	}else if function == "read_private_vote" {
+		return read_private_vote(stub, args)
+	}else if function == "get_ballots_by_voter" {
+		return get_ballots_by_voter(stub, args)
+	}else if function == "get_ballots_by_candidate" {
+		return get_ballots_by_candidate(stub, args)
+	}else if function == "get_voter_history" {
+		return get_voter_history(stub, args)
+	}else if function == "get_candidate_history" {
+		return get_candidate_history(stub, args)
+	}else if function == "create_election" {
+		return create_election(stub, args)
+	}else if function == "open_election" {
+		return open_election(stub, args)
+	}else if function == "close_election" {
+		return close_election(stub, args)
+	}else if function == "archive_election" {
+		return archive_election(stub, args)
+	}else if function == "finalize_election" {
+		return finalize_election(stub, args)
+	}else if function == "read_election" {
+		return read_election(stub, args)
+	}else if function == "list_voters" {
+		return list_voters(stub, args)
+	}else if function == "list_candidates" {
+		return list_candidates(stub, args)
+	}else if function == "cast_ranked_ballot" {
+		return cast_ranked_ballot(stub, args)
+	}else if function == "read_ranked_ballot" {
+		return read_ranked_ballot(stub, args)
+	}else if function == "tally_irv" {
+		return tally_irv(stub, args)
+	}else if function == "tally_stv" {
+		return tally_stv(stub, args)
+	}else if function == "cast_ballot" {
+		return cast_ballot(stub, args)
+	}else if function == "tally_ballots" {
+		return tally_ballots(stub, args)
+	}else if function == "read_marked_ballot" {
+		return read_marked_ballot(stub, args)
+	}else if function == "preview_vote_cost" {
+		return preview_vote_cost(stub, args)
+	}else if function == "verify_invariants" {
+		return verify_invariants(stub, args)
+	}else if function == "get_results" {
+		return get_results(stub, args)
+	}else if function == "migrate_state" {
+		return migrate_state(stub, args)
 	}
 
 	// error out
@@ -171,48 +1119,87 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 // ============================================================================================================================
 // Init Voter - create a new voter, store into chaincode state
 //
+// The claim hash is the hex encoded sha256 of a secret the registrar hands to the voter's owner out of band, only the
+// caller presenting that secret can claim the voter.
+//
 // Inputs - Array of Strings
-//           0     ,         1   	.
-//      voter id   , TokensBought	.
-//           "v001",       "100" 	.
+//           0     	,      1     ,         2   	,		3			.
+//      election id	,  voter id  , TokensBought	,	claim hash		.
+//           "e001"	,     "v001" ,       "100" 	,	"2bb80d..."		.
 // ============================================================================================================================
 func init_voter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
 	fmt.Println("starting init_voter")
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
 	}
 
-	//input sanitation
-	err = sanitize_arguments(args)
+	//input sanitation, the hash is longer than the usual arguments
+	err = sanitize_arguments(args[0:3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimHash := strings.ToLower(args[3])
+	if decoded, err := hex.DecodeString(claimHash); err != nil || len(decoded) != sha256.Size {
+		return shim.Error("Expecting a hex encoded sha256 hash - " + args[3])
+	}
+
+	//voters can register while the election is being prepared or while it is open
+	election, err := check_election_status(stub, args[0], ElectionDraft, ElectionOpen)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
+	tokensBought, err := parse_count(args[2])
+	if err != nil || tokensBought == 0 {
+		return shim.Error("TokensBought must be a positive number - " + args[2])
+	}
+	if tokensBought > max_tokens(election) {
+		return shim.Error("A voter can buy at most " + strconv.FormatUint(max_tokens(election), 10) + " tokens in election " + election.EID)
+	}
+
 	var voter Voter
-	voter.VID = args[0]
-	voter.TokensBought = args[1]
-	voter.TokensRemaining = args[1]
-	voter.Enabled = true
-	fmt.Println("ID: " + voter.VID + ", TokensBought: " + voter.TokensBought + ", TokensRemaining: " + voter.TokensRemaining + ", Active: " + strconv.FormatBool(voter.Enabled))
+	voter.ElectionID = args[0]
+	voter.VID = args[1]
+	voter.TokensBought = tokensBought
+	voter.TokensRemaining = tokensBought
+	voter.Status = VoterActive
+	voter.StatusReason = ReasonRegistered
+	voter.ClaimHash = claimHash
+	voter.StatusChangedAt, err = get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("ID: " + voter.VID + ", TokensBought: " + strconv.FormatUint(voter.TokensBought, 10) + ", TokensRemaining: " + strconv.FormatUint(voter.TokensRemaining, 10) + ", Status: " + voter.Status)
 	
-	//check if user already exists
-	_, err = get_voter(stub, voter.VID)
+	//check if user already exists in this election
+	_, err = get_voter(stub, voter.ElectionID, voter.VID)
 	if err == nil {
 		fmt.Println("This voter already exists - " + voter.VID)
 		return shim.Error("This voter already exists - " + voter.VID)
 	}
+	if !is_not_found(err) {
+		return shim.Error(err.Error())
+	}
 
 	//store user
-	voterAsBytes, _ := json.Marshal(voter)                         //convert to array of bytes
 	fmt.Println(" putting state in block")
-	err = stub.PutState(voter.VID, voterAsBytes)                    //store voter by its Id
+	err = put_voter(stub, voter)                                    //store voter by election and Id
 	if err != nil {
 		fmt.Println("Could not store voter")
 		return shim.Error(err.Error())
 	}
+	err = record_receipt(stub, voter, tokensBought)
+	if err != nil {
+		fmt.Println("Could not store receipt")
+		return shim.Error(err.Error())
+	}
 	
+	err = emit_event(stub, EventVoterCreated, voter.ElectionID, voter)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	fmt.Println(voter.VID + " voter has been stored")
 	fmt.Println("- end init_voter")
 	return shim.Success(nil)
@@ -220,304 +1207,349 @@ func init_voter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 
 // ============================================================================================================================
-// Init Candidate - create a new candidate, store into chaincode state
+// Suspend Voter - stop a voter from voting until an admin reinstates them
 //
 // Inputs - Array of Strings
-//           	0	    ,	         1   			.
-//      candidate id   	, 	candidate's name		.
-//           "c001"		,   "christopher wallace"	.
+//           0     	,      1     ,     2   			.
+//      election id	,  voter id  ,   reason code	.
+//           "e001"	,     "v001" ,   "duplicate" 	.
 // ============================================================================================================================
-func init_candidate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var err error
-	fmt.Println("starting init_candidate")
+func suspend_voter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting suspend_voter")
+	return change_voter_status(stub, args, VoterSuspended)
+}
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+
+// ============================================================================================================================
+// Reinstate Voter - lift a suspension, the voter is active again or exhausted if they have no tokens left
+//
+// Inputs - Array of Strings
+//           0     	,      1     ,     2   			.
+//      election id	,  voter id  ,   reason code	.
+//           "e001"	,     "v001" ,   "appeal" 		.
+// ============================================================================================================================
+func reinstate_voter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting reinstate_voter")
+	return change_voter_status(stub, args, VoterActive)
+}
+
+
+// ============================================================================================================================
+// Change Voter Status - admin status change with one of the adminReasons
+// ============================================================================================================================
+func change_voter_status(stub shim.ChaincodeStubInterface, args []string, to string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
 	}
 
 	//input sanitation
-	err = sanitize_arguments(args)
+	err := sanitize_arguments(args)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	var candidate Candidate
-	candidate.CID =  args[0]
-	candidate.CandidateName = args[1]
-	candidate.VotesReceived = "0"
-	fmt.Println("ID: " + candidate.CID + ", CandidateName: " + candidate.CandidateName + ", VotesReceived: " + candidate.VotesReceived)
+	eid := args[0]
+	vid := args[1]
+	reason := args[2]
 
-	//check if user already exists
-	_, err = get_candidate(stub, candidate.CID)
-	if err == nil {
-		fmt.Println("This candidate already exists - " + candidate.CID)
-		return shim.Error("This candidate already exists - " + candidate.CID)
+	err = check_admin_reason(reason)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	//store user
-	candidateAsBytes, _ := json.Marshal(candidate)                         //convert to array of bytes
-	fmt.Println(" putting state in block")
-	err = stub.PutState(candidate.CID, candidateAsBytes)                    //store candidate by its Id
+	_, err = check_election_status(stub, eid, ElectionDraft, ElectionOpen, ElectionClosed)
 	if err != nil {
-		fmt.Println("Could not store candidate")
 		return shim.Error(err.Error())
 	}
-	
-	fmt.Println(candidate.CID + " candidate has been stored")
-	fmt.Println("- end init_candidate")
-	return shim.Success(nil)
-}
-
 
-// ============================================================================================================================
-// delete_voter() - remove a voter from state and from voter index
-//
-// Inputs - Array of strings
-//      0      	.
-//     id 		.
-//	"v001"		.
-// ============================================================================================================================
-func delete_voter(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
-	fmt.Println("starting delete_voter")
+	voter, err := get_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	// reinstating only applies to suspended voters, and one without tokens comes back exhausted
+	if to == VoterActive {
+		if voter.Status != VoterSuspended {
+			return shim.Error("This voter is not suspended - " + vid)
+		}
+		if voter.TokensRemaining == 0 {
+			to = VoterExhausted
+		}
 	}
 
-	// input sanitation
-	err := sanitize_arguments(args)
+	now, err := get_tx_time(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	vid := args[0]
-
-	// get the voter
-	voter, err := get_voter(stub, vid)
-	if err != nil{
-		fmt.Println("Failed to find voter by vid " + vid)
+	err = set_voter_status(&voter, to, reason, now)
+	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// remove the voter
-	err = stub.DelState(vid) //remove the key from chaincode state
+	err = put_voter(stub, voter)
 	if err != nil {
-		return shim.Error("Failed to delete state")
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
 	}
 
-	fmt.Println(voter.VID + " voter has been deleted")
-	fmt.Println("- end delete_voter")
+	err = emit_event(stub, EventVoterStatusChanged, voter.ElectionID, voter)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end change_voter_status")
 	return shim.Success(nil)
 }
 
 
 // ============================================================================================================================
-// delete_candidate() - remove a candidate from state and from candidate index
+// Buy Tokens - top up an existing voter
 //
-// Inputs - Array of strings
-//      0      	.
-//     id 		.
-//	"c001"		.
+// Both TokensBought and TokensRemaining go up, a voter that had run out of tokens is enabled again, and the
+// purchase is kept as a Receipt. Nothing is paid on chain, so only registrars and admins, who confirm the payment
+// outside of it, can sell tokens.
+//
+// Inputs - Array of Strings
+//           0     	,      1     ,     2   	.
+//      election id	,  voter id  ,   tokens	.
+//           "e001"	,     "v001" ,    "50" 	.
 // ============================================================================================================================
-func delete_candidate(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
-	fmt.Println("starting delete_candidate")
+func buy_tokens(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting buy_tokens")
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
 	}
 
-	// input sanitation
-	err := sanitize_arguments(args)
+	//input sanitation
+	err = sanitize_arguments(args)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	cid := args[0]
+	eid := args[0]
+	vid := args[1]
 
-	// get the candidate
-	candidate, err := get_candidate(stub, cid)
-	if err != nil{
-		fmt.Println("Failed to find candidate by cid " + cid)
+	tokens, err := parse_count(args[2])
+	if err != nil || tokens == 0 {
+		return shim.Error("Tokens must be a positive number - " + args[2])
+	}
+
+	election, err := check_election_status(stub, eid, ElectionDraft, ElectionOpen)
+	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// remove the candidate
-	err = stub.DelState(cid) //remove the key from chaincode state
+	voter, err := get_voter(stub, eid, vid)
 	if err != nil {
-		return shim.Error("Failed to delete state")
+		return shim.Error(err.Error())
 	}
 
-	fmt.Println(candidate.CID + " candidate has been deleted")
-	fmt.Println("- end delete_candidate")
-	return shim.Success(nil)
+	voter.TokensBought, err = add_count(voter.TokensBought, tokens)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.TokensBought > max_tokens(election) {
+		return shim.Error("A voter can buy at most " + strconv.FormatUint(max_tokens(election), 10) + " tokens in election " + eid)
+	}
+	voter.TokensRemaining, err = add_count(voter.TokensRemaining, tokens)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.Status == VoterRemoved {
+		return shim.Error("This voter has been removed - " + vid)
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sync_voter_status(&voter, now)
+
+	err = put_voter(stub, voter)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+	err = record_receipt(stub, voter, tokens)
+	if err != nil {
+		fmt.Println("Could not store receipt")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventTokensBought, voter.ElectionID, voter)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("The voter '" + vid + "' bought " + strconv.FormatUint(tokens, 10) + " tokens")
+	fmt.Println("- end buy_tokens")
+	return shim.Success([]byte(stub.GetTxID()))
 }
 
 
 // ============================================================================================================================
-// Transfer Vote
+// Init Candidate - create a new candidate, store into chaincode state
 //
 // Inputs - Array of Strings
-//       0     	,        1      	,        		2 			.
-//  voter id  	,   candidate id  	, 	tokens to use for vote	.
-// 	"v001"		, 	"c001"			, 				"20"		. 
+//           	0	    ,	     1	        ,	         2   			.
+//      election id   	, 	candidate id   	, 	candidate's name		.
+//           "e001"		,   "c001"		    ,   "christopher wallace"	.
 // ============================================================================================================================
-func transfer_vote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var voter Voter
-	var candidate Candidate
+func init_candidate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
-	fmt.Println("starting transfer_vote")
+	fmt.Println("starting init_candidate")
 
 	if len(args) != 3 {
-		fmt.Println("Incorrect number of arguments. Expecting 3")
 		return shim.Error("Incorrect number of arguments. Expecting 3")
 	}
 
-	// input sanitation
+	//input sanitation
 	err = sanitize_arguments(args)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	vid := args[0]
-	cid := args[1]
-	tokensToUse := args[2]
-
-	tTU, err := strconv.Atoi(tokensToUse)
-	if tTU <= 0 {
-		fmt.Println("This voter didn't insert enough tokens to use- " + tokensToUse)
-		return shim.Error("This voter didn't insert enough tokens to use- " + tokensToUse)
-	}
-
-	fmt.Println("The voter '" + vid + "' votes for the candidate '" + cid + "' with the amount of- |" + tokensToUse + "| -tokens.")
-
-	//check if voter already exists
-	voter, err = get_voter(stub, vid)
-	if err != nil{
-		fmt.Println("Failed to find voter by vid " + vid)
+	//the ballot is fixed once the election opens
+	_, err = check_election_status(stub, args[0], ElectionDraft)
+	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	if err != nil || voter.Enabled == false {
-		fmt.Println("This voter does not exist or is disabled- " + voter.VID)
-		fmt.Println(voter)
-		return shim.Error("This voter does not exist or is disabled- " + voter.VID)
-	}
+	var candidate Candidate
+	candidate.ElectionID = args[0]
+	candidate.CID =  args[1]
+	candidate.CandidateName = args[2]
+	candidate.VotesReceived = 0
+	candidate.Status = CandidateActive
+	fmt.Println("ID: " + candidate.CID + ", CandidateName: " + candidate.CandidateName + ", VotesReceived: " + strconv.FormatUint(candidate.VotesReceived, 10))
 
-	//check if user already exists
-	candidate, err = get_candidate(stub, cid)
-	if err != nil {
-		return shim.Error("This candidate does not exist - " + cid)//cid
+	//check if user already exists in this election
+	_, err = get_candidate(stub, candidate.ElectionID, candidate.CID)
+	if err == nil {
+		fmt.Println("This candidate already exists - " + candidate.CID)
+		return shim.Error("This candidate already exists - " + candidate.CID)
 	}
-
-	
-	tB := voter.TokensBought
-	tR, err := strconv.Atoi(voter.TokensRemaining)
-	vR, err := strconv.Atoi(candidate.VotesReceived)
-
-	if (tR >= tTU && tR > 0) {
-		tR = tR - tTU
-		vR = vR + tTU
-		voter.TokensRemaining = strconv.Itoa(tR)
-		fmt.Println("The voter's remaining tokens are " + voter.TokensRemaining)
-        candidate.VotesReceived = strconv.Itoa(vR)
-        fmt.Println("The candidate has recieved in total '" + candidate.VotesReceived + "' tokens.")
-	}else if (tR > 0 && tTU >tR) {
-		fmt.Println("Not enough tokens. Your maximum amount of tokens is: - |" + voter.TokensRemaining + "| -")
-		return shim.Error("Not enough tokens. Your maximum amount of tokens is: - |" + voter.TokensRemaining + "| -")
-	}
-
-	if (tR <= 0) {
-		var v = []string {vid}
-		fmt.Println("The voter with vid " + vid + " is gonna be disabled")
-		voter.TokensRemaining = strconv.Itoa(tR)
-		voter,_ = disable_voter(stub, v)
-		voter.VID = vid
-		voter.TokensBought = tB
-	}
-
-	//store voter
-	fmt.Println(voter)
-	voterAsBytes, _ := json.Marshal(voter)
-	err = stub.PutState(voter.VID, voterAsBytes)
-	if err != nil{
-		fmt.Println("Could not store voter")
+	if !is_not_found(err) {
 		return shim.Error(err.Error())
 	}
 
 	//store user
-	candidateAsBytes, _ := json.Marshal(candidate)                         //convert to array of bytes
-	err = stub.PutState(candidate.CID, candidateAsBytes)                    //store candidate by its Id
+	fmt.Println(" putting state in block")
+	err = put_candidate(stub, candidate)                                    //store candidate by election and Id
 	if err != nil {
 		fmt.Println("Could not store candidate")
 		return shim.Error(err.Error())
 	}
-
-	fmt.Println("- end transfer_vote")
+	
+	err = emit_event(stub, EventCandidateCreated, candidate.ElectionID, candidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println(candidate.CID + " candidate has been stored")
+	fmt.Println("- end init_candidate")
 	return shim.Success(nil)
 }
 
 
-//*********************************************************************************
-//********************************** READ LEDGER **********************************
-//*********************************************************************************
 // ============================================================================================================================
-// Read Voter- read a voter from ledger
+// Create Question - create a new question, store into chaincode state
 //
-// Inputs - Array of strings
-//      0      	.
-//     id 		.
-//	"v001"		.
+// The options are fixed, without any the question gets DefaultOptions (yes, no, abstain). The quorum is the percentage
+// of eligible voters that must answer, "0" for none.
 //
-// Returns - string
+// Inputs - Array of Strings
+//           	0	    ,	     1	        ,	         2   			,	  3		,	  4..				.
+//      election id   	, 	question id   	, 	text					,  quorum	,	options				.
+//           "e001"		,   "q001"		    ,   "raise the dues"		,	"50"	,	"yes", "no"			.
 // ============================================================================================================================
-func read_voter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var jsonResp string
+func create_question(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
-	fmt.Println("starting read_voter")
+	fmt.Println("starting create_question")
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting key of the var to query")
+	if len(args) < 4 {
+		return shim.Error("Incorrect number of arguments. Expecting at least 4")
 	}
 
-	// input sanitation
+	//input sanitation
 	err = sanitize_arguments(args)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	vid := args[0]
-	voterAsBytes, err := stub.GetState(vid)
+	//like the candidates, questions are fixed once the election opens
+	_, err = check_election_status(stub, args[0], ElectionDraft)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + vid + "\"}"
-		return shim.Error(jsonResp)
+		return shim.Error(err.Error())
 	}
 
-	var voter Voter
-	json.Unmarshal(voterAsBytes, &voter)
-	fmt.Println(voter)
-	fmt.Println("- end read")
+	var question Question
+	question.ElectionID = args[0]
+	question.QID = args[1]
+	question.Text = args[2]
+	question.Quorum, err = parse_count(args[3])
+	if err != nil || question.Quorum > 100 {
+		return shim.Error("The quorum is a percentage from 0 to 100 - " + args[3])
+	}
 
-	return shim.Success(voterAsBytes)                  //send it onward
+	options := args[4:]
+	if len(options) == 0 {
+		options = DefaultOptions
+	}
+	if len(options) < 2 {
+		return shim.Error("A question needs at least 2 options")
+	}
+	for _, option := range options {
+		for _, tally := range question.Tallies {
+			if tally.Option == option {
+				return shim.Error("Options must be unique - " + option)
+			}
+		}
+		question.Tallies = append(question.Tallies, OptionTally{Option: option})
+	}
+
+	//check if question already exists in this election
+	_, err = get_question(stub, question.ElectionID, question.QID)
+	if err == nil {
+		fmt.Println("This question already exists - " + question.QID)
+		return shim.Error("This question already exists - " + question.QID)
+	}
+	if !is_not_found(err) {
+		return shim.Error(err.Error())
+	}
+
+	err = put_question(stub, question)
+	if err != nil {
+		fmt.Println("Could not store question")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventQuestionCreated, question.ElectionID, question)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println(question.QID + " question has been stored")
+	fmt.Println("- end create_question")
+	return shim.Success(nil)
 }
 
 
 // ============================================================================================================================
-// Read Candidate- read a candidate from ledger
+// Answer Question - pick an option of a question, weighed with the voter's tokens
 //
-// Inputs - Array of strings
-//      0      	.
-//     id 		.
-//	"c001"		.
+// Inputs - Array of Strings
+//       0     	,      1     	,        2      	,        3		,		4 			.
+//  election id	,  voter id  	,   question id  	, 	  option	,	tokens to use	.
+// 	"e001"		,  "v001"		, 	"q001"			, 	  "yes"		,		"20"		.
 //
-// Returns - string
+// Returns - the answer id
 // ============================================================================================================================
-func read_candidate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var jsonResp string
+func answer_question(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var answer Answer
 	var err error
-	fmt.Println("starting read candidate")
+	fmt.Println("starting answer_question")
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting key of the var to query")
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
 	}
 
 	// input sanitation
@@ -526,87 +1558,5477 @@ func read_candidate(stub shim.ChaincodeStubInterface, args []string) pb.Response
 		return shim.Error(err.Error())
 	}
 
-	cid := args[0]
-	candidateAsbytes, err := stub.GetState(cid)
+	eid := args[0]
+	vid := args[1]
+	qid := args[2]
+	option := args[3]
+
+	// questions are answered in the open like public votes
+	election, err := check_election_status(stub, eid, ElectionOpen)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + cid + "\"}"
-		return shim.Error(jsonResp)
+		return shim.Error(err.Error())
 	}
-
-	var candidate Candidate
-	json.Unmarshal(candidateAsbytes, &candidate)
-	fmt.Println(candidate)
-	fmt.Println("- end read")
-
-	return shim.Success(candidateAsbytes)                  //send it onward
-}
-
-
-//*********************************************************************************
-//********************************** LIB ******************************************
-//*********************************************************************************
-// ============================================================================================================================
-// Get Voter - get a voter asset from ledger
-//
-// ============================================================================================================================
-func get_voter(stub shim.ChaincodeStubInterface, vid string) (Voter, error) {
-	var voter Voter
-	voterAsBytes, err := stub.GetState(vid) //getState retreives a key/value from the ledger. If the key does not exist in the state database, (nil, nil) is returned.
-
-	if err != nil {                                          
-		return voter, errors.New("Failed to find voter - " + vid)
+	if election.BallotMode != BallotPublic {
+		return shim.Error("Questions can only be answered in public elections - " + eid)
 	}
-	json.Unmarshal(voterAsBytes, &voter) //un stringify it aka JSON.parse()
 
-	if voter.VID != vid {  
-		return voter, errors.New("Voter does not exist - " + vid)
+	tokens, err := parse_count(args[4])
+	if err != nil || tokens == 0 {
+		return shim.Error("This voter didn't insert enough tokens to use- " + args[4])
 	}
 
-	return voter, nil
-}
+	voter, err := get_active_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.Status != VoterActive {
+		return shim.Error("This voter is " + voter.Status + " - " + vid)
+	}
 
+	question, err := get_question(stub, eid, qid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	found := -1
+	for i, tally := range question.Tallies {
+		if tally.Option == option {
+			found = i
+		}
+	}
+	if found < 0 {
+		return shim.Error("This option does not exist - " + option)
+	}
 
-// ============================================================================================================================
-// Get Canddidate - get a candidate asset from ledger
-// ============================================================================================================================
-func get_candidate(stub shim.ChaincodeStubInterface, cid string) (Candidate, error) {
-	var candidate Candidate
-	candidateAsBytes, err := stub.GetState(cid) //getState retreives a key/value from the ledger. If the key does not exist in the state database, (nil, nil) is returned.
+	key, err := stub.CreateCompositeKey(AnswerObject, []string{eid, qid, vid})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	answerAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to find answer of " + vid)
+	}
+	if answerAsBytes != nil {
+		return shim.Error("This voter has already answered question " + qid + " - " + vid)
+	}
 
-	if err != nil {             
-		return candidate, errors.New("Failed to find candidate - " + cid)
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	json.Unmarshal(candidateAsBytes, &candidate) //un stringify it aka JSON.parse()
 
-	if candidate.CID != cid {
-		return candidate, errors.New("Candidate does not exist - " + cid) 
+	voter.TokensRemaining, err = sub_count(voter.TokensRemaining, tokens)
+	if err != nil {
+		return shim.Error("Not enough tokens. Your maximum amount of tokens is: - |" + strconv.FormatUint(voter.TokensRemaining, 10) + "| -")
 	}
+	sync_voter_status(&voter, now)
+	question.Tallies[found].Votes, err = add_count(question.Tallies[found].Votes, tokens)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	question.Voters++
 
-	return candidate, nil
-}
+	answer.ObjectType = AnswerObject
+	answer.AnswerID = stub.GetTxID()
+	answer.ElectionID = eid
+	answer.QID = qid
+	answer.VID = vid
+	answer.Option = option
+	answer.Tokens = tokens
+	answer.AnsweredAt = now
+	answerAsBytes, _ = json.Marshal(answer)
+	err = stub.PutState(key, answerAsBytes)
+	if err != nil {
+		fmt.Println("Could not store answer")
+		return shim.Error(err.Error())
+	}
+
+	err = put_voter(stub, voter)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+	err = put_question(stub, question)
+	if err != nil {
+		fmt.Println("Could not store question")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventQuestionAnswered, answer.ElectionID, answer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("The voter '" + vid + "' answered '" + option + "' to '" + qid + "' with " + strconv.FormatUint(tokens, 10) + " tokens")
+	fmt.Println("- end answer_question")
+	return shim.Success([]byte(answer.AnswerID))
+}
+
+
+// ============================================================================================================================
+// Remove Voter - take a voter out of the election for good
+//
+// The voter is not deleted, its ballots keep pointing at it. It moves to the removed status with the reason, the time and
+// the identity that removed it, and from then on only auditors can read it.
+//
+// Inputs - Array of strings
+//      0      		,	   1      	,		2							.
+//  election id		,     id 		,	reason code (optional)			.
+//	"e001"			,	"v001"		,	"duplicate"						.
+// ============================================================================================================================
+func remove_voter(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
+	fmt.Println("starting remove_voter")
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+	reason := ReasonAdministrative
+	if len(args) == 3 {
+		reason = args[2]
+	}
+
+	err = check_admin_reason(reason)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	_, err = check_election_status(stub, eid, ElectionDraft, ElectionOpen, ElectionClosed)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// get the voter
+	voter, err := get_voter(stub, eid, vid)
+	if err != nil{
+		fmt.Println("Failed to find voter by vid " + vid)
+		return shim.Error(err.Error())
+	}
+
+	identity, err := get_identity(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = set_voter_status(&voter, VoterRemoved, reason, now)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	voter.RemovalReason = reason
+	voter.RemovedAt = now
+	voter.RemovedByMSPID = identity.MSPID
+	voter.RemovedByID = identity.ID
+	err = put_voter(stub, voter)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventVoterRemoved, voter.ElectionID, voter)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println(voter.VID + " voter has been removed")
+	fmt.Println("- end remove_voter")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Withdraw Candidate - take a candidate out of the running, it stays readable as a tombstone
+//
+// What happens to the votes depends on the election's withdrawal policy:
+//	block	- candidates can only withdraw while the election is a draft, before anyone voted
+//	freeze	- the votes stay with the candidate, counted in the totals but out of the running
+//	refund	- every ballot for the candidate is revoked and its tokens go back to whoever paid them
+// Either way the candidate takes no more votes.
+//
+// Inputs - Array of strings
+//      0      		,	   1      	,		2				.
+//  election id		,     id 		,	reason (optional)	.
+//	"e001"			,	"c001"		,	"ineligible"		.
+// ============================================================================================================================
+func withdraw_candidate(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
+	fmt.Println("starting withdraw_candidate")
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	cid := args[1]
+
+	election, err := check_election_status(stub, eid, ElectionDraft, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	policy := election.Withdrawal
+	if policy == "" {
+		policy = WithdrawalBlock
+	}
+	if policy == WithdrawalBlock && election.Status != ElectionDraft {
+		return shim.Error("Election '" + eid + "' is " + election.Status + ", candidates can only withdraw before it opens")
+	}
+
+	// get the candidate
+	candidate, err := get_candidate(stub, eid, cid)
+	if err != nil{
+		fmt.Println("Failed to find candidate by cid " + cid)
+		return shim.Error(err.Error())
+	}
+	if candidate.Status == CandidateWithdrawn {
+		return shim.Error("This candidate has already withdrawn - " + cid)
+	}
+
+	identity, err := get_identity(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if policy == WithdrawalRefund {
+		err = refund_candidate(stub, election, cid, now)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		candidate.VotesReceived = 0
+	}
+
+	candidate.Status = CandidateWithdrawn
+	candidate.Withdrawal = policy
+	if len(args) == 3 {
+		candidate.WithdrawalReason = args[2]
+	}
+	candidate.WithdrawnAt = now
+	candidate.WithdrawnByMSPID = identity.MSPID
+	candidate.WithdrawnByID = identity.ID
+	err = put_candidate(stub, candidate)
+	if err != nil {
+		fmt.Println("Could not store candidate")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventCandidateRemoved, candidate.ElectionID, candidate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println(candidate.CID + " candidate has withdrawn, votes: " + policy)
+	fmt.Println("- end withdraw_candidate")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Transfer Vote
+//
+// In a quadratic election the last argument is the number of votes to add for the candidate, they cost
+// (v+N)*(v+N) - v*v tokens where v is the number of votes the voter already gave that candidate.
+//
+// With the optional delegator the voter casts the vote as a delegate, spending tokens the delegator escrowed with
+// delegate_tokens instead of its own. The ballot keeps the delegator.
+//
+// Inputs - Array of Strings
+//       0     	,      1     	,        2      	,        		3 			,		4					.
+//  election id	,  voter id  	,   candidate id  	, 	tokens to use for vote	,	delegator (optional)	.
+// 	"e001"		,  "v001"		, 	"c001"			, 				"20"		,		"v002"				.
+// ============================================================================================================================
+func transfer_vote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var voter Voter
+	var candidate Candidate
+	var err error
+	fmt.Println("starting transfer_vote")
+
+	if len(args) != 4 && len(args) != 5 {
+		fmt.Println("Incorrect number of arguments. Expecting 4 or 5")
+		return shim.Error("Incorrect number of arguments. Expecting 4 or 5")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+	cid := args[2]
+	tokensToUse := args[3]
+	delegator := ""
+	if len(args) == 5 {
+		delegator = args[4]
+	}
+
+	// votes are only accepted while the election is open
+	election, err := check_election_status(stub, eid, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.BallotMode == BallotCommitReveal {
+		return shim.Error("Election '" + eid + "' uses sealed ballots, use commit_vote and reveal_vote")
+	}
+	if election.BallotMode == BallotPrivate {
+		return shim.Error("Election '" + eid + "' uses private ballots, use cast_private_vote")
+	}
+	if election_method(election) != MethodTokens {
+		return shim.Error("Election '" + eid + "' uses " + election.Method + " ballots, use cast_ballot")
+	}
+	if delegator != "" && election.VoteCost == VoteCostQuadratic {
+		return shim.Error("Election '" + eid + "' is quadratic, delegated tokens cannot be spent in it")
+	}
+
+	tTU, err := parse_count(tokensToUse)
+	if err != nil || tTU == 0 {
+		fmt.Println("This voter didn't insert enough tokens to use- " + tokensToUse)
+		return shim.Error("This voter didn't insert enough tokens to use- " + tokensToUse)
+	}
+
+	fmt.Println("The voter '" + vid + "' votes for the candidate '" + cid + "' with the amount of- |" + tokensToUse + "| -tokens.")
+
+	//only the identity that claimed the voter can spend its tokens
+	voter, err = get_active_voter(stub, eid, vid)
+	if err != nil{
+		fmt.Println("Failed to find voter by vid " + vid)
+		return shim.Error(err.Error())
+	}
+
+	//a delegate that spent its own tokens can still spend delegated ones
+	if voter.Status == VoterExhausted && delegator == "" {
+		fmt.Println("This voter is " + voter.Status + " - " + voter.VID)
+		return shim.Error("This voter is " + voter.Status + " - " + voter.VID)
+	}
+
+	//check if user already exists
+	candidate, err = get_running_candidate(stub, eid, cid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//in a linear election every token is a vote, in a quadratic one the amount is votes and they are priced
+	votes := tTU
+	var allocation Allocation
+	if election.VoteCost == VoteCostQuadratic {
+		allocation, err = get_allocation(stub, eid, vid, cid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		tTU, err = quadratic_cost(allocation.Votes, votes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		fmt.Println(strconv.FormatUint(votes, 10) + " more votes cost " + strconv.FormatUint(tTU, 10) + " tokens")
+		allocation.Votes += votes
+		allocation.TokensSpent += tTU
+	}
+
+	//delegated tokens come out of the delegator's escrow, the delegate's own balance is untouched
+	var delegation Delegation
+	if delegator != "" {
+		delegation, err = get_spendable_delegation(stub, eid, delegator, vid, cid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		delegation.Tokens, err = sub_count(delegation.Tokens, tTU)
+		if err != nil {
+			return shim.Error("Not enough delegated tokens. The maximum amount of tokens is: - |" + strconv.FormatUint(delegation.Tokens, 10) + "| -")
+		}
+		delegation.TokensSpent += tTU
+	} else {
+		tR, err := sub_count(voter.TokensRemaining, tTU)
+		if err != nil {
+			fmt.Println("Not enough tokens. Your maximum amount of tokens is: - |" + strconv.FormatUint(voter.TokensRemaining, 10) + "| -")
+			return shim.Error("Not enough tokens. Your maximum amount of tokens is: - |" + strconv.FormatUint(voter.TokensRemaining, 10) + "| -")
+		}
+		voter.TokensRemaining = tR
+		fmt.Println("The voter's remaining tokens are " + strconv.FormatUint(voter.TokensRemaining, 10))
+	}
+	vR, err := add_count(candidate.VotesReceived, votes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	candidate.VotesReceived = vR
+	fmt.Println("The candidate has recieved in total '" + strconv.FormatUint(candidate.VotesReceived, 10) + "' votes.")
+
+	if delegator != "" {
+		err = put_delegation(stub, delegation)
+		if err != nil {
+			fmt.Println("Could not store delegation")
+			return shim.Error(err.Error())
+		}
+	} else {
+		//a voter without tokens left is exhausted
+		sync_voter_status(&voter, now)
+
+		//store voter
+		fmt.Println(voter)
+		err = put_voter(stub, voter)
+		if err != nil{
+			fmt.Println("Could not store voter")
+			return shim.Error(err.Error())
+		}
+	}
+
+	//store user
+	err = put_candidate(stub, candidate)                                    //store candidate by election and Id
+	if err != nil {
+		fmt.Println("Could not store candidate")
+		return shim.Error(err.Error())
+	}
+
+	if election.VoteCost == VoteCostQuadratic {
+		err = put_allocation(stub, allocation)
+		if err != nil {
+			fmt.Println("Could not store allocation")
+			return shim.Error(err.Error())
+		}
+	}
+
+	//keep a record of this vote
+	ballot, err := record_ballot(stub, eid, vid, cid, tTU, votes, delegator)
+	if err != nil {
+		fmt.Println("Could not store ballot")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventVoteCast, eid, VoteEvent{Ballot: ballot, Candidate: candidate})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end transfer_vote")
+	return shim.Success([]byte(ballot.BallotID))
+}
+
+
+// ============================================================================================================================
+// Revoke Vote - take back a ballot while the election is open, if the election allows it
+//
+// The tokens go back to the voter (who is enabled again if they had run out), the candidate loses them, and the
+// ballot is marked revoked so its history shows both the vote and the revocation. Delegated tokens go back to the
+// delegator's balance rather than to the delegation.
+//
+// Inputs - Array of Strings
+//       0     	,      1     	,        2      	.
+//  election id	,  voter id  	,   ballot id	  	.
+// 	"e001"		,  "v001"		, 	"3a1f..."		.
+// ============================================================================================================================
+func revoke_vote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting revoke_vote")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation, the ballot id is a transaction id and longer than the usual arguments
+	err = sanitize_arguments(args[0:2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[2]) == 0 || len(args[2]) > 64 {
+		return shim.Error("Argument 2 must be a transaction id")
+	}
+
+	eid := args[0]
+	vid := args[1]
+	ballotID := args[2]
+
+	election, err := check_election_status(stub, eid, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !election.AllowRevocation {
+		return shim.Error("Election '" + eid + "' does not allow revoking votes")
+	}
+
+	voter, err := get_active_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ballot, err := get_ballot(stub, eid, ballotID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ballot.VID != vid {
+		return shim.Error("This ballot was not cast by voter - " + vid)
+	}
+	if ballot.Revoked {
+		return shim.Error("This ballot has already been revoked - " + ballotID)
+	}
+
+	//the votes of a withdrawn candidate were refunded or are frozen
+	candidate, err := get_running_candidate(stub, eid, ballot.CID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//ballots cast before vote costs were introduced only carry tokens
+	votes := ballot.Votes
+	if votes == 0 {
+		votes = ballot.Tokens
+	}
+	refund := ballot.Tokens
+
+	//a quadratic refund is priced at the voter's current allocation, later votes for the candidate cost more than this one
+	var allocation Allocation
+	if election.VoteCost == VoteCostQuadratic {
+		allocation, err = get_allocation(stub, eid, vid, ballot.CID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		allocation.Votes, err = sub_count(allocation.Votes, votes)
+		if err != nil {
+			return shim.Error("Voter " + vid + " holds fewer votes for " + ballot.CID + " than the ballot - " + err.Error())
+		}
+		refund, err = quadratic_cost(allocation.Votes, votes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		allocation.TokensSpent, err = sub_count(allocation.TokensSpent, refund)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	candidate.VotesReceived, err = sub_count(candidate.VotesReceived, votes)
+	if err != nil {
+		return shim.Error("Candidate " + ballot.CID + " holds fewer votes than the ballot - " + err.Error())
+	}
+	refunded := voter
+	if ballot.Delegator != "" {
+		refunded, err = get_voter(stub, eid, ballot.Delegator)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	refunded.TokensRemaining, err = add_count(refunded.TokensRemaining, refund)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//an exhausted voter is active again, a suspended one stays suspended
+	sync_voter_status(&refunded, now)
+	ballot.Revoked = true
+	ballot.RevokedAt = now
+	ballot.RevokedBy = stub.GetTxID()
+
+	err = put_voter(stub, refunded)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+	err = put_candidate(stub, candidate)
+	if err != nil {
+		fmt.Println("Could not store candidate")
+		return shim.Error(err.Error())
+	}
+	err = put_ballot(stub, ballot)
+	if err != nil {
+		fmt.Println("Could not store ballot")
+		return shim.Error(err.Error())
+	}
+	if election.VoteCost == VoteCostQuadratic {
+		err = put_allocation(stub, allocation)
+		if err != nil {
+			fmt.Println("Could not store allocation")
+			return shim.Error(err.Error())
+		}
+	}
+
+	err = emit_event(stub, EventVoteRevoked, eid, VoteEvent{Ballot: ballot, Candidate: candidate})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("The voter '" + refunded.VID + "' got back " + strconv.FormatUint(refund, 10) + " tokens from '" + ballot.CID + "'")
+	fmt.Println("- end revoke_vote")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Issue Claim - give an unclaimed voter a new claim hash, for voters migrated from before claim secrets or whose
+// owner lost the secret
+//
+// Inputs - Array of strings
+//      0      		,	   1      	,		2			.
+//  election id		,   voter id	,	claim hash		.
+//	"e001"			,	"v001"		,	"2bb80d..."		.
+// ============================================================================================================================
+func issue_claim(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting issue_claim")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation, the hash is longer than the usual arguments
+	err := sanitize_arguments(args[0:2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimHash := strings.ToLower(args[2])
+	if decoded, err := hex.DecodeString(claimHash); err != nil || len(decoded) != sha256.Size {
+		return shim.Error("Expecting a hex encoded sha256 hash - " + args[2])
+	}
+
+	_, err = check_election_status(stub, args[0], ElectionDraft, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	voter, err := get_voter(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.Status == VoterRemoved {
+		return shim.Error("This voter has been removed - " + voter.VID)
+	}
+	if voter.OwnerID != "" {
+		return shim.Error("This voter has already been claimed - " + voter.VID)
+	}
+
+	voter.ClaimHash = claimHash
+	err = put_voter(stub, voter)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventClaimIssued, voter.ElectionID, voter)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end issue_claim")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Claim Voter - bind a voter to the enrollment certificate of the caller
+//
+// The registrar hands the voter id and its claim secret to the owner out of band, the owner then claims it with the
+// secret in the transient map under "secret", so it never reaches the ledger. From then on only that identity can spend
+// the voter's tokens. An identity can claim a single voter per election.
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,   voter id	.
+//	"e001"			,	"v001"		.
+// ============================================================================================================================
+func claim_voter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting claim_voter")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+
+	_, err = check_election_status(stub, eid, ElectionDraft, ElectionOpen, ElectionClosed, ElectionFinalized)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	voter, err := get_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.Status == VoterRemoved {
+		return shim.Error("This voter has been removed - " + vid)
+	}
+	if voter.OwnerID != "" {
+		return shim.Error("This voter has already been claimed - " + vid)
+	}
+
+	// voter ids are easy to guess, the secret proves the caller is the owner the registrar meant
+	if voter.ClaimHash == "" {
+		return shim.Error("This voter has no claim secret, ask the registrar to issue_claim - " + vid)
+	}
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("Failed to get transient data - " + err.Error())
+	}
+	secret, found := transient[ClaimSecretKey]
+	if !found || len(secret) == 0 {
+		return shim.Error("The claim secret must be passed in the transient map under '" + ClaimSecretKey + "'")
+	}
+	sum := sha256.Sum256(secret)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(voter.ClaimHash)) != 1 {
+		return shim.Error("Wrong claim secret for voter - " + vid)
+	}
+
+	identity, err := get_identity(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// one voter per identity and election
+	ownerKey, err := stub.CreateCompositeKey(OwnerIndex, []string{eid, identity.MSPID, identity.ID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimed, err := stub.GetState(ownerKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if claimed != nil {
+		return shim.Error("This identity has already claimed voter " + string(claimed) + " in election " + eid)
+	}
+
+	voter.OwnerMSPID = identity.MSPID
+	voter.OwnerID = identity.ID
+	voter.ClaimHash = ""
+	err = put_voter(stub, voter)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(ownerKey, []byte(vid))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventVoterClaimed, eid, voter)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println(vid + " voter has been claimed by " + identity.MSPID)
+	fmt.Println("- end claim_voter")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Delegate Tokens - hand tokens to another voter of the election, who spends them with transfer_vote
+//
+// The tokens leave the delegator's balance and are escrowed in the delegation until spent or revoked. The topic is the
+// candidate they may go to, "*" (the default) for any candidate. Delegating a topic again to the same delegate adds to
+// the escrow. Delegations that would form a cycle, or a chain longer than MaxDelegationDepth counting the voters who
+// delegated to the delegator, are refused for every candidate the tokens could go to.
+//
+// Inputs - Array of Strings
+//       0     	,      1     	,        2      	,        3		,		4				.
+//  election id	,  voter id  	,   delegate id  	, 	  tokens	,	topic (optional)	.
+// 	"e001"		,  "v001"		, 	"v002"			, 	  "20"		,		"c001"			.
+// ============================================================================================================================
+func delegate_tokens(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting delegate_tokens")
+
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 4 or 5")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+	delegateID := args[2]
+	topic := AnyTopic
+	if len(args) == 5 {
+		topic = args[4]
+	}
+
+	tokens, err := parse_count(args[3])
+	if err != nil || tokens == 0 {
+		return shim.Error("Expecting a positive number of tokens - " + args[3])
+	}
+	if delegateID == vid {
+		return shim.Error("A voter cannot delegate to itself - " + vid)
+	}
+
+	election, err := check_election_status(stub, eid, ElectionDraft, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election_method(election) != MethodTokens || election.BallotMode != BallotPublic || election.VoteCost == VoteCostQuadratic {
+		return shim.Error("Tokens can only be delegated in public, linear token elections - " + eid)
+	}
+
+	voter, err := get_active_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.Status != VoterActive {
+		return shim.Error("This voter is " + voter.Status + " - " + vid)
+	}
+
+	delegate, err := get_voter(stub, eid, delegateID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if delegate.Status == VoterSuspended || delegate.Status == VoterRemoved {
+		return shim.Error("The delegate is " + delegate.Status + " - " + delegateID)
+	}
+	if topic != AnyTopic {
+		_, err = get_running_candidate(stub, eid, topic)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	err = check_delegation_chains(stub, eid, vid, delegateID, topic)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	delegation, err := get_delegation(stub, eid, vid, topic)
+	if err == nil && delegation.Delegate != delegateID {
+		return shim.Error("Topic " + topic + " is already delegated to " + delegation.Delegate + ", revoke it first")
+	}
+	if err != nil && !is_not_found(err) {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	voter.TokensRemaining, err = sub_count(voter.TokensRemaining, tokens)
+	if err != nil {
+		return shim.Error("Not enough tokens. Your maximum amount of tokens is: - |" + strconv.FormatUint(voter.TokensRemaining, 10) + "| -")
+	}
+	sync_voter_status(&voter, now)
+
+	if delegation.Delegate == "" {
+		delegation.ElectionID = eid
+		delegation.Delegator = vid
+		delegation.Delegate = delegateID
+		delegation.Topic = topic
+		delegation.CreatedAt = now
+	}
+	delegation.Tokens, err = add_count(delegation.Tokens, tokens)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	delegation.TokensDelegated, err = add_count(delegation.TokensDelegated, tokens)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = put_voter(stub, voter)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+	err = put_delegation(stub, delegation)
+	if err != nil {
+		fmt.Println("Could not store delegation")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventTokensDelegated, eid, delegation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("The voter '" + vid + "' delegated " + strconv.FormatUint(tokens, 10) + " tokens to '" + delegateID + "' for " + topic)
+	fmt.Println("- end delegate_tokens")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Revoke Delegation - end a delegation, the tokens the delegate did not spend go back to the delegator
+//
+// Inputs - Array of Strings
+//       0     	,      1     	,        2      		.
+//  election id	,  voter id  	,   topic (optional)	.
+// 	"e001"		,  "v001"		, 	"c001"				.
+// ============================================================================================================================
+func revoke_delegation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting revoke_delegation")
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+	topic := AnyTopic
+	if len(args) == 3 {
+		topic = args[2]
+	}
+
+	_, err = check_election_status(stub, eid, ElectionDraft, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	voter, err := get_active_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	delegation, err := get_delegation(stub, eid, vid, topic)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	voter.TokensRemaining, err = add_count(voter.TokensRemaining, delegation.Tokens)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sync_voter_status(&voter, now)
+
+	err = put_voter(stub, voter)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+	err = delete_delegation(stub, delegation)
+	if err != nil {
+		fmt.Println("Could not delete delegation")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventDelegationRevoked, eid, delegation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("The voter '" + vid + "' got back " + strconv.FormatUint(delegation.Tokens, 10) + " tokens from '" + delegation.Delegate + "'")
+	fmt.Println("- end revoke_delegation")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Create Election - create a new election in draft status, store into chaincode state
+//
+// Options are optional "name=value" arguments:
+//	mode=public|commit_reveal|private	- how votes are cast, public by default
+//	unrevealed=refund|forfeit			- commit_reveal only, what happens to commitments never revealed, refund by default
+//	revocation=true|false				- public only, whether voters may revoke_vote while the election is open
+//	max_tokens=N						- most tokens a voter can buy in total, DefaultMaxTokens by default
+//	vote_cost=linear|quadratic			- public only, quadratic makes N votes for a candidate cost N*N tokens, linear by default
+//	method=tokens|irv|stv|approval|score	- public only, how ballots are cast and counted (see cast_ballot), tokens by default
+//	seats=N								- stv only, how many candidates are elected, 1 by default
+//	quota=droop|hare					- stv only, the votes a candidate needs to be elected, droop by default
+//	withdrawal=block|freeze|refund		- what withdraw_candidate does with the votes of a candidate, block by default
+//
+// Inputs - Array of Strings
+//           0     	,            1   			,		2..						.
+//      election id	,          title   			,	  options					.
+//           "e001"	,   "board election 2017"	,	"mode=commit_reveal"		.
+// ============================================================================================================================
+func create_election(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting create_election")
+
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting at least 2")
+	}
+
+	//input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var election Election
+	election.EID = args[0]
+	election.Title = args[1]
+	election.Status = ElectionDraft
+	election.CreatedAt = now
+	election.BallotMode = BallotPublic
+	election.VoteCost = VoteCostLinear
+	election.Method = MethodTokens
+	election.Withdrawal = WithdrawalBlock
+	election.MaxTokens = DefaultMaxTokens
+	err = parse_election_options(&election, args[2:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("ID: " + election.EID + ", Title: " + election.Title + ", Status: " + election.Status + ", BallotMode: " + election.BallotMode)
+
+	//check if election already exists
+	_, err = get_election(stub, election.EID)
+	if err == nil {
+		fmt.Println("This election already exists - " + election.EID)
+		return shim.Error("This election already exists - " + election.EID)
+	}
+	if !is_not_found(err) {
+		return shim.Error(err.Error())
+	}
+
+	err = put_election(stub, election)
+	if err != nil {
+		fmt.Println("Could not store election")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventElectionCreated, election.EID, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println(election.EID + " election has been stored")
+	fmt.Println("- end create_election")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Open Election - start accepting votes, only from draft
+//
+// Inputs - Array of strings
+//      0      	.
+//     id 		.
+//	"e001"		.
+// ============================================================================================================================
+func open_election(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return change_election_status(stub, args, ElectionDraft, ElectionOpen)
+}
+
+
+// ============================================================================================================================
+// Close Election - stop accepting votes, only from open
+//
+// Inputs - Array of strings
+//      0      	.
+//     id 		.
+//	"e001"		.
+// ============================================================================================================================
+func close_election(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return change_election_status(stub, args, ElectionOpen, ElectionClosed)
+}
+
+
+// ============================================================================================================================
+// Finalize Election - freeze the results of a closed election
+//
+// Inputs - Array of strings
+//      0      	.
+//     id 		.
+//	"e001"		.
+// ============================================================================================================================
+func finalize_election(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return change_election_status(stub, args, ElectionClosed, ElectionFinalized)
+}
+
+
+// ============================================================================================================================
+// Archive Election - freeze a closed or finalized election and everything in it
+//
+// Every function that writes checks the election status, and none accepts archived, so voters, candidates, ballots,
+// commitments, delegations and questions of the election can only be read from then on. A commit_reveal election has
+// to be finalized first so its commitments are settled.
+//
+// Inputs - Array of strings
+//      0      	.
+//     id 		.
+//	"e001"		.
+// ============================================================================================================================
+func archive_election(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting archive_election")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := check_election_status(stub, args[0], ElectionClosed, ElectionFinalized)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.BallotMode == BallotCommitReveal && election.Status != ElectionFinalized {
+		return shim.Error("Election '" + election.EID + "' has unsettled commitments, finalize it first")
+	}
+
+	identity, err := get_identity(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election.Status = ElectionArchived
+	election.ArchivedAt = now
+	election.ArchivedByMSPID = identity.MSPID
+	election.ArchivedByID = identity.ID
+	err = put_election(stub, election)
+	if err != nil {
+		fmt.Println("Could not store election")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventElectionStatusChanged, election.EID, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println(election.EID + " election is now " + election.Status)
+	fmt.Println("- end archive_election")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Change Election Status - move an election from one status to the next and stamp the time of the move
+// ============================================================================================================================
+func change_election_status(stub shim.ChaincodeStubInterface, args []string, from string, to string) pb.Response {
+	fmt.Println("starting change_election_status, " + from + " -> " + to)
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := check_election_status(stub, args[0], from)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election.Status = to
+	switch to {
+	case ElectionOpen:
+		election.OpenedAt = now
+	case ElectionClosed:
+		election.ClosedAt = now
+		if election.BallotMode == BallotPrivate {
+			err = tally_private_votes(stub, election)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	case ElectionFinalized:
+		election.FinalizedAt = now
+		if election.BallotMode == BallotCommitReveal {
+			err = settle_commitments(stub, election, now)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+
+	err = put_election(stub, election)
+	if err != nil {
+		fmt.Println("Could not store election")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventElectionStatusChanged, election.EID, election)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println(election.EID + " election is now " + election.Status)
+	fmt.Println("- end change_election_status")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Commit Vote - seal a vote of a commit_reveal election and escrow its tokens
+//
+// The hash is the hex encoded sha256 of "<candidate id>:<tokens>:<nonce>". Keep the nonce secret until reveal_vote.
+//
+// Inputs - Array of Strings
+//       0     	,      1     	,        2      	,        		3 			.
+//  election id	,  voter id  	,   sha256 hash  	, 	tokens to escrow		.
+// 	"e001"		,  "v001"		, 	"9f86d0..."		, 				"20"		.
+//
+// Returns - the commit id to pass to reveal_vote
+// ============================================================================================================================
+func commit_vote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting commit_vote")
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	// input sanitation, the hash is longer than the usual arguments
+	err = sanitize_arguments([]string{args[0], args[1], args[3]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+	hash := strings.ToLower(args[2])
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+		return shim.Error("Expecting a hex encoded sha256 hash - " + args[2])
+	}
+
+	tokens, err := parse_count(args[3])
+	if err != nil || tokens == 0 {
+		return shim.Error("This voter didn't insert enough tokens to use- " + args[3])
+	}
+
+	election, err := check_election_status(stub, eid, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.BallotMode != BallotCommitReveal {
+		return shim.Error("Election '" + eid + "' does not use sealed ballots, use transfer_vote")
+	}
+
+	voter, err := get_active_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.Status != VoterActive {
+		return shim.Error("This voter is " + voter.Status + " - " + vid)
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// escrow the tokens
+	voter.TokensRemaining, err = sub_count(voter.TokensRemaining, tokens)
+	if err != nil {
+		return shim.Error("Not enough tokens. Your maximum amount of tokens is: - |" + strconv.FormatUint(voter.TokensRemaining, 10) + "| -")
+	}
+	sync_voter_status(&voter, now)
+
+	var commitment Commitment
+	commitment.CommitID = stub.GetTxID()
+	commitment.ElectionID = eid
+	commitment.VID = vid
+	commitment.Hash = hash
+	commitment.Tokens = tokens
+	commitment.Status = CommitmentSealed
+	commitment.CommittedAt = now
+
+	err = put_voter(stub, voter)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+	err = put_commitment(stub, commitment)
+	if err != nil {
+		fmt.Println("Could not store commitment")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventVoteCommitted, eid, commitment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end commit_vote")
+	return shim.Success([]byte(commitment.CommitID))
+}
+
+
+// ============================================================================================================================
+// Reveal Vote - open a sealed vote once the election is closed, its tokens are then counted for the candidate
+//
+// Inputs - Array of Strings
+//       0     	,      1     	,        2      	,        3      	,        4      	.
+//  election id	,  voter id  	,   commit id	  	,   candidate id  	, 	nonce			.
+// 	"e001"		,  "v001"		, 	"3a1f..."		, 	"c001"			, 	"s3cret"		.
+// ============================================================================================================================
+func reveal_vote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting reveal_vote")
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	// input sanitation, the commit id is a transaction id and longer than the usual arguments
+	err = sanitize_arguments([]string{args[0], args[1], args[3], args[4]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[2]) == 0 || len(args[2]) > 64 {
+		return shim.Error("Argument 2 must be a transaction id")
+	}
+
+	eid := args[0]
+	vid := args[1]
+	commitID := args[2]
+	cid := args[3]
+	nonce := args[4]
+
+	election, err := check_election_status(stub, eid, ElectionClosed)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.BallotMode != BallotCommitReveal {
+		return shim.Error("Election '" + eid + "' does not use sealed ballots")
+	}
+
+	_, err = get_active_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	commitment, err := get_commitment(stub, eid, vid, commitID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if commitment.Status != CommitmentSealed {
+		return shim.Error("This commitment has already been " + commitment.Status + " - " + commitID)
+	}
+
+	if commitment_hash(cid, commitment.Tokens, nonce) != commitment.Hash {
+		return shim.Error("The revealed vote does not match commitment - " + commitID)
+	}
+
+	candidate, err := get_running_candidate(stub, eid, cid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	candidate.VotesReceived, err = add_count(candidate.VotesReceived, commitment.Tokens)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	commitment.Status = CommitmentRevealed
+	commitment.CID = cid
+	commitment.SettledAt = now
+
+	err = put_candidate(stub, candidate)
+	if err != nil {
+		fmt.Println("Could not store candidate")
+		return shim.Error(err.Error())
+	}
+	err = put_commitment(stub, commitment)
+	if err != nil {
+		fmt.Println("Could not store commitment")
+		return shim.Error(err.Error())
+	}
+	ballot, err := record_ballot(stub, eid, vid, cid, commitment.Tokens, commitment.Tokens, "")
+	if err != nil {
+		fmt.Println("Could not store ballot")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventVoteRevealed, eid, VoteEvent{Ballot: ballot, Candidate: candidate})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("The voter '" + vid + "' revealed " + strconv.FormatUint(commitment.Tokens, 10) + " tokens for '" + cid + "'")
+	fmt.Println("- end reveal_vote")
+	return shim.Success(nil)
+}
+
+
+// ============================================================================================================================
+// Cast Private Vote - vote in a private election without putting the choice on the channel
+//
+// The ballot travels in the transient map under "ballot" as {"CID":"c001","Tokens":20,"Salt":"..."} so it never
+// reaches the transaction proposal. It is stored in the PrivateCollection, the channel only gets its hash and the voter's
+// new balance. The transaction reads every candidate of the election and writes none of them, so neither its read set
+// nor its write set points at the choice. The candidates' totals are counted from the collection by close_election.
+//
+// Inputs - Array of Strings
+//       0     	,      1     	.
+//  election id	,  voter id  	.
+// 	"e001"		,  "v001"		.
+//
+// Returns - the ballot id
+// ============================================================================================================================
+func cast_private_vote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var privateVote PrivateVote
+	var err error
+	fmt.Println("starting cast_private_vote")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("Failed to get transient data - " + err.Error())
+	}
+	ballotAsBytes, found := transient[PrivateBallotKey]
+	if !found {
+		return shim.Error("The ballot must be passed in the transient map under '" + PrivateBallotKey + "'")
+	}
+	err = json.Unmarshal(ballotAsBytes, &privateVote)
+	if err != nil {
+		return shim.Error("Failed to decode the private ballot - " + err.Error())
+	}
+	err = sanitize_arguments([]string{privateVote.CID, privateVote.Salt})
+	if err != nil {
+		return shim.Error("The private ballot needs a CID and a Salt - " + err.Error())
+	}
+	if privateVote.Tokens == 0 {
+		return shim.Error("This voter didn't insert enough tokens to use")
+	}
+
+	election, err := check_election_status(stub, eid, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.BallotMode != BallotPrivate {
+		return shim.Error("Election '" + eid + "' does not use private ballots")
+	}
+
+	voter, err := get_active_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.Status != VoterActive {
+		return shim.Error("This voter is " + voter.Status + " - " + vid)
+	}
+
+	// reading only the chosen candidate would put its key in the read set
+	candidates, err := get_all_candidates(stub, eid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	running := false
+	for _, candidate := range candidates {
+		if candidate.CID == privateVote.CID {
+			if candidate.Status == CandidateWithdrawn {
+				return shim.Error("This candidate has withdrawn - " + privateVote.CID)
+			}
+			running = true
+		}
+	}
+	if !running {
+		return shim.Error("This candidate does not exist - " + privateVote.CID)
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	voter.TokensRemaining, err = sub_count(voter.TokensRemaining, privateVote.Tokens)
+	if err != nil {
+		return shim.Error("Not enough tokens. Your maximum amount of tokens is: - |" + strconv.FormatUint(voter.TokensRemaining, 10) + "| -")
+	}
+	sync_voter_status(&voter, now)
+
+	privateVote.ObjectType = PrivateVoteObject
+	privateVote.BallotID = stub.GetTxID()
+	privateVote.ElectionID = eid
+	privateVote.VID = vid
+	privateVoteAsBytes, _ := json.Marshal(privateVote)
+	sum := sha256.Sum256(privateVoteAsBytes)
+
+	var ballotHash BallotHash
+	ballotHash.ObjectType = BallotHashObject
+	ballotHash.BallotID = privateVote.BallotID
+	ballotHash.ElectionID = eid
+	ballotHash.VID = vid
+	ballotHash.Hash = hex.EncodeToString(sum[:])
+	ballotHash.CastAt = now
+	ballotHashAsBytes, _ := json.Marshal(ballotHash)
+
+	key, err := stub.CreateCompositeKey(PrivateVoteObject, []string{eid, vid, privateVote.BallotID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutPrivateData(PrivateCollection, key, privateVoteAsBytes)
+	if err != nil {
+		fmt.Println("Could not store private vote")
+		return shim.Error(err.Error())
+	}
+
+	key, err = stub.CreateCompositeKey(BallotHashObject, []string{eid, vid, privateVote.BallotID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(key, ballotHashAsBytes)
+	if err != nil {
+		fmt.Println("Could not store ballot hash")
+		return shim.Error(err.Error())
+	}
+
+	err = put_voter(stub, voter)
+	if err != nil {
+		fmt.Println("Could not store voter")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventPrivateVoteCast, eid, ballotHash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end cast_private_vote")
+	return shim.Success([]byte(privateVote.BallotID))
+}
+
+
+// ============================================================================================================================
+// Cast Ranked Ballot - rank candidates of an irv or stv election, most preferred first
+//
+// Candidates left out are not ranked at all. A voter casts one ranked ballot, it cannot be changed.
+//
+// Inputs - Array of Strings
+//       0     	,      1     	,	   2..    						.
+//  election id	,  voter id  	,	candidate ids in order 			.
+// 	"e001"		,  "v001"		,	"c002", "c001", "c003"			.
+//
+// Returns - the ballot id
+// ============================================================================================================================
+func cast_ranked_ballot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var ballot RankedBallot
+	var err error
+	fmt.Println("starting cast_ranked_ballot")
+
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting at least 3")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+
+	election, err := check_election_status(stub, eid, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !is_ranked(election) {
+		return shim.Error("Election '" + eid + "' does not use ranked ballots")
+	}
+
+	voter, err := get_active_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.Status != VoterActive {
+		return shim.Error("This voter is " + voter.Status + " - " + vid)
+	}
+
+	_, err = get_ranked_ballot(stub, eid, vid)
+	if err == nil {
+		return shim.Error("This voter has already cast a ranked ballot - " + vid)
+	}
+
+	ranked := map[string]bool{}
+	for _, cid := range args[2:] {
+		if ranked[cid] {
+			return shim.Error("A candidate can only be ranked once - " + cid)
+		}
+		_, err = get_running_candidate(stub, eid, cid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		ranked[cid] = true
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ballot.ObjectType = RankedBallotObject
+	ballot.BallotID = stub.GetTxID()
+	ballot.ElectionID = eid
+	ballot.VID = vid
+	ballot.Rankings = args[2:]
+	ballot.CastAt = now
+
+	key, err := stub.CreateCompositeKey(RankedBallotObject, []string{eid, vid})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballotAsBytes, _ := json.Marshal(ballot)
+	err = stub.PutState(key, ballotAsBytes)
+	if err != nil {
+		fmt.Println("Could not store ranked ballot")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventBallotCast, eid, ballot)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("The voter '" + vid + "' ranked " + strings.Join(ballot.Rankings, " > "))
+	fmt.Println("- end cast_ranked_ballot")
+	return shim.Success([]byte(ballot.BallotID))
+}
+
+
+// ============================================================================================================================
+// Cast Ballot - vote in an election whatever its method, the ballot content depends on it
+//
+//	tokens		- candidate id, tokens to use (as transfer_vote)
+//	irv, stv	- candidate ids, most preferred first (as cast_ranked_ballot)
+//	approval	- candidate ids of every approved candidate
+//	score		- "candidate id=score" for every scored candidate, scores from 0 to MaxScore
+//
+// Inputs - Array of Strings
+//       0     	,      1     	,	   2..    						.
+//  election id	,  voter id  	,	ballot content 					.
+// 	"e001"		,  "v001"		,	"c001=7", "c002=10"				.
+//
+// Returns - the ballot id
+// ============================================================================================================================
+func cast_ballot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting cast_ballot")
+
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting at least 3")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := get_election(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballotType, found := ballotTypes[election_method(election)]
+	if !found {
+		return shim.Error("Unknown voting method - " + election.Method)
+	}
+
+	response := ballotType.Cast(stub, args)
+	fmt.Println("- end cast_ballot")
+	return response
+}
+
+
+// ============================================================================================================================
+// Migrate State - one-shot rewrite of the assets that older versions stored under their bare id
+//
+// Every election, voter and candidate found under a raw key is moved into its composite key namespace and gets
+// its docType. Voters and candidates that predate elections are moved into the given election. Once nothing is
+// left under raw keys running it again does nothing.
+//
+// Inputs - Array of strings
+//      0      	.
+//  election id	.
+//	"e001"		.
+//
+// Returns - JSON with the number of migrated assets of each type
+// ============================================================================================================================
+func migrate_state(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type MigrationReport struct {
+		Elections  int `json:"Elections"`
+		Voters     int `json:"Voters"`
+		Candidates int `json:"Candidates"`
+	}
+	var report MigrationReport
+	var elections []Election
+	var voters []Voter
+	var candidates []Candidate
+	var rawKeys []string
+	fmt.Println("starting migrate_state")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+
+	// a range over the whole simple key space never returns composite keys, so this only sees old assets
+	resultsIterator, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(kv.Value, &fields) != nil {
+			continue                                            //not an asset, e.g. selftest
+		}
+
+		if fields["EID"] != nil {
+			var election Election
+			err = json.Unmarshal(kv.Value, &election)
+			if err != nil || election.EID != kv.Key {
+				return shim.Error("Election stored under the wrong key - " + kv.Key)
+			}
+			elections = append(elections, election)
+		} else if fields["VID"] != nil {
+			var voter Voter
+			err = json.Unmarshal(kv.Value, &voter)
+			if err != nil {
+				return shim.Error("Failed to decode voter " + kv.Key + " - " + err.Error())
+			}
+			if voter.VID != kv.Key {
+				return shim.Error("Voter stored under the wrong key - " + kv.Key)
+			}
+			if voter.ElectionID == "" {
+				voter.ElectionID = eid
+			}
+			voters = append(voters, voter)
+		} else if fields["CID"] != nil {
+			var candidate Candidate
+			err = json.Unmarshal(kv.Value, &candidate)
+			if err != nil {
+				return shim.Error("Failed to decode candidate " + kv.Key + " - " + err.Error())
+			}
+			if candidate.CID != kv.Key {
+				return shim.Error("Candidate stored under the wrong key - " + kv.Key)
+			}
+			if candidate.ElectionID == "" {
+				candidate.ElectionID = eid
+			}
+			candidates = append(candidates, candidate)
+		} else {
+			continue
+		}
+		rawKeys = append(rawKeys, kv.Key)
+	}
+
+	// the target election must exist already or be one of the elections being migrated
+	target, err := get_election(stub, eid)
+	if err != nil && !is_not_found(err) {
+		return shim.Error(err.Error())
+	}
+	targetFound := err == nil
+	if targetFound && target.Status == ElectionArchived {
+		return shim.Error("Election '" + eid + "' is archived")
+	}
+	for _, election := range elections {
+		if election.EID == eid {
+			targetFound = true
+		}
+		if _, err = get_election(stub, election.EID); err == nil {
+			return shim.Error("This election already exists - " + election.EID)
+		} else if !is_not_found(err) {
+			return shim.Error(err.Error())
+		}
+		if err = put_election(stub, election); err != nil {
+			return shim.Error(err.Error())
+		}
+		report.Elections++
+	}
+	if !targetFound && (len(voters) > 0 || len(candidates) > 0) {
+		return shim.Error("Election does not exist - " + eid)
+	}
+
+	for _, voter := range voters {
+		if _, err = get_voter(stub, voter.ElectionID, voter.VID); err == nil {
+			return shim.Error("This voter already exists - " + voter.VID)
+		} else if !is_not_found(err) {
+			return shim.Error(err.Error())
+		}
+		if err = put_voter(stub, voter); err != nil {
+			return shim.Error(err.Error())
+		}
+		report.Voters++
+	}
+
+	for _, candidate := range candidates {
+		if _, err = get_candidate(stub, candidate.ElectionID, candidate.CID); err == nil {
+			return shim.Error("This candidate already exists - " + candidate.CID)
+		} else if !is_not_found(err) {
+			return shim.Error(err.Error())
+		}
+		if err = put_candidate(stub, candidate); err != nil {
+			return shim.Error(err.Error())
+		}
+		report.Candidates++
+	}
+
+	for _, key := range rawKeys {
+		if err = stub.DelState(key); err != nil {
+			return shim.Error("Failed to delete state")
+		}
+	}
+
+	err = emit_event(stub, EventStateMigrated, args[0], report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	reportAsBytes, _ := json.Marshal(report)
+	fmt.Println(string(reportAsBytes))
+	fmt.Println("- end migrate_state")
+	return shim.Success(reportAsBytes)
+}
+
+
+//*********************************************************************************
+//********************************** READ LEDGER **********************************
+//*********************************************************************************
+// ============================================================================================================================
+// Read Voter- read a voter from ledger
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,     id 		.
+//	"e001"			,	"v001"		.
+//
+// Returns - string
+// ============================================================================================================================
+func read_voter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var jsonResp string
+	var err error
+	fmt.Println("starting read_voter")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting election and key of the var to query")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	vid := args[1]
+	key, err := voter_key(stub, args[0], vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	voterAsBytes, err := stub.GetState(key)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + vid + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	// old records are sent back in the current format, records that do not parse are refused
+	if voterAsBytes != nil {
+		var voter Voter
+		err = json.Unmarshal(voterAsBytes, &voter)
+		if err != nil {
+			return shim.Error("Failed to decode voter " + vid + " - " + err.Error())
+		}
+		err = check_tombstone_access(stub, voter)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		voterAsBytes, _ = json.Marshal(voter)
+		fmt.Println(voter)
+	}
+	fmt.Println("- end read")
+
+	return shim.Success(voterAsBytes)                  //send it onward
+}
+
+
+// ============================================================================================================================
+// Read Candidate- read a candidate from ledger
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,     id 		.
+//	"e001"			,	"c001"		.
+//
+// Returns - string
+// ============================================================================================================================
+func read_candidate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var jsonResp string
+	var err error
+	fmt.Println("starting read candidate")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting election and key of the var to query")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	cid := args[1]
+	key, err := candidate_key(stub, args[0], cid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	candidateAsbytes, err := stub.GetState(key)
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + cid + "\"}"
+		return shim.Error(jsonResp)
+	}
+
+	// old records are sent back in the current format, records that do not parse are refused
+	if candidateAsbytes != nil {
+		var candidate Candidate
+		err = json.Unmarshal(candidateAsbytes, &candidate)
+		if err != nil {
+			return shim.Error("Failed to decode candidate " + cid + " - " + err.Error())
+		}
+		candidateAsbytes, _ = json.Marshal(candidate)
+		fmt.Println(candidate)
+	}
+	fmt.Println("- end read")
+
+	return shim.Success(candidateAsbytes)                  //send it onward
+}
+
+
+// ============================================================================================================================
+// Read Election- read an election from ledger
+//
+// Inputs - Array of strings
+//      0      	.
+//     id 		.
+//	"e001"		.
+//
+// Returns - string
+// ============================================================================================================================
+func read_election(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting read_election")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting key of the var to query")
+	}
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := get_election(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	electionAsBytes, _ := json.Marshal(election)
+	fmt.Println(election)
+	fmt.Println("- end read")
+
+	return shim.Success(electionAsBytes)                  //send it onward
+}
+
+
+// ============================================================================================================================
+// Get Results - tally every candidate of an election
+//
+// Candidates are sorted by votes received (ties broken by candidate id so every peer returns the same document).
+// Winners holds every candidate sharing the highest count, Tie is set when there is more than one of them.
+//
+// Inputs - Array of strings
+//      0      	.
+//  election id	.
+//	"e001"		.
+//
+// Returns - JSON ElectionResults
+// ============================================================================================================================
+func get_results(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var results ElectionResults
+	fmt.Println("starting get_results")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := get_election(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	results.ElectionID = election.EID
+	results.Status = election.Status
+	results.Candidates = []CandidateResult{}
+	results.Winners = []string{}
+
+	candidates, err := get_all_candidates(stub, election.EID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, candidate := range candidates {
+		results.TotalVotes, err = add_count(results.TotalVotes, candidate.VotesReceived)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		results.Candidates = append(results.Candidates, CandidateResult{CID: candidate.CID, CandidateName: candidate.CandidateName, VotesReceived: candidate.VotesReceived, Withdrawn: candidate.Status == CandidateWithdrawn})
+	}
+
+	sort.SliceStable(results.Candidates, func(i, j int) bool {
+		if results.Candidates[i].VotesReceived != results.Candidates[j].VotesReceived {
+			return results.Candidates[i].VotesReceived > results.Candidates[j].VotesReceived
+		}
+		return results.Candidates[i].CID < results.Candidates[j].CID
+	})
+
+	// withdrawn candidates cannot win
+	var top uint64
+	for _, result := range results.Candidates {
+		if !result.Withdrawn && result.VotesReceived > top {
+			top = result.VotesReceived
+		}
+	}
+	for i := range results.Candidates {
+		if results.TotalVotes > 0 {
+			results.Candidates[i].Percentage = float64(results.Candidates[i].VotesReceived) * 100 / float64(results.TotalVotes)
+		}
+		// nobody wins an election without votes
+		if !results.Candidates[i].Withdrawn && top > 0 && results.Candidates[i].VotesReceived == top {
+			results.Winners = append(results.Winners, results.Candidates[i].CID)
+		}
+	}
+	results.Tie = len(results.Winners) > 1
+
+	resultsAsBytes, _ := json.Marshal(results)
+	fmt.Println("- end get_results")
+	return shim.Success(resultsAsBytes)
+}
+
+
+// ============================================================================================================================
+// Read Ranked Ballot - read the ranked ballot of a voter
+//
+// Inputs - Array of strings
+//      0      	,	   1      	.
+//  election id	,  voter id  	.
+//	"e001"		,	"v001"		.
+//
+// Returns - JSON RankedBallot
+// ============================================================================================================================
+func read_ranked_ballot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting read_ranked_ballot")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ballot, err := get_ranked_ballot(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ballotAsBytes, _ := json.Marshal(ballot)
+	fmt.Println("- end read_ranked_ballot")
+	return shim.Success(ballotAsBytes)
+}
+
+
+// ============================================================================================================================
+// Tally IRV - count the ranked ballots of an election by instant runoff
+//
+// Every round each ballot counts for its most preferred continuing candidate. A candidate holding more than half of
+// the ballots that still count is elected, otherwise the candidate with the fewest votes is eliminated and the next
+// round starts. Ties for last place eliminate the candidate with fewer first preferences, then the one whose id
+// sorts last, so every peer returns the same log. Anyone can rerun the count from the ranked ballots.
+//
+// Inputs - Array of strings
+//      0      	.
+//  election id	.
+//	"e001"		.
+//
+// Returns - JSON IRVResults
+// ============================================================================================================================
+func tally_irv(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var results IRVResults
+	fmt.Println("starting tally_irv")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := get_election(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.Method != MethodIRV {
+		return shim.Error("Election '" + election.EID + "' does not use ranked ballots")
+	}
+
+	candidates, err := get_all_candidates(stub, election.EID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// rankings pass over withdrawn candidates to the next preference
+	cids := []string{}
+	for _, candidate := range candidates {
+		if candidate.Status == CandidateWithdrawn {
+			continue
+		}
+		cids = append(cids, candidate.CID)
+	}
+
+	ballots, err := get_ranked_ballots(stub, election.EID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rankings := [][]string{}
+	for _, ballot := range ballots {
+		rankings = append(rankings, ballot.Rankings)
+	}
+
+	results.ElectionID = election.EID
+	results.Status = election.Status
+	results.Ballots = uint64(len(ballots))
+	results.Rounds, results.Winner = run_irv(cids, rankings)
+
+	resultsAsBytes, _ := json.Marshal(results)
+	fmt.Println("- end tally_irv")
+	return shim.Success(resultsAsBytes)
+}
+
+
+// ============================================================================================================================
+// Tally STV - count the ranked ballots of a multi-seat election by single transferable vote
+//
+// The returned log holds the quota and every round's fixed point tallies, elections, surplus transfers and eliminations,
+// see STVResults, so the count can be recomputed from the ranked ballots. Ties for last place are broken like tally_irv.
+//
+// Inputs - Array of strings
+//      0      	.
+//  election id	.
+//	"e001"		.
+//
+// Returns - JSON STVResults
+// ============================================================================================================================
+func tally_stv(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var results STVResults
+	fmt.Println("starting tally_stv")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := get_election(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.Method != MethodSTV {
+		return shim.Error("Election '" + election.EID + "' is not an stv election")
+	}
+
+	candidates, err := get_all_candidates(stub, election.EID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// rankings pass over withdrawn candidates to the next preference
+	cids := []string{}
+	for _, candidate := range candidates {
+		if candidate.Status == CandidateWithdrawn {
+			continue
+		}
+		cids = append(cids, candidate.CID)
+	}
+
+	ballots, err := get_ranked_ballots(stub, election.EID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rankings := [][]string{}
+	for _, ballot := range ballots {
+		rankings = append(rankings, ballot.Rankings)
+	}
+
+	results.ElectionID = election.EID
+	results.Status = election.Status
+	results.Seats = election.Seats
+	results.QuotaMethod = election.Quota
+	results.Scale = STVScale
+	results.Ballots = uint64(len(ballots))
+	results.Quota, err = stv_quota(results.Ballots, election.Seats, election.Quota)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	results.Rounds, results.Elected, err = run_stv(cids, rankings, election.Seats, results.Quota)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsAsBytes, _ := json.Marshal(results)
+	fmt.Println("- end tally_stv")
+	return shim.Success(resultsAsBytes)
+}
+
+
+// ============================================================================================================================
+// Tally Ballots - count an election whatever its method
+//
+// tokens elections return get_results, irv tally_irv, stv tally_stv, approval and score elections MarkResults.
+//
+// Inputs - Array of strings
+//      0      	.
+//  election id	.
+//	"e001"		.
+//
+// Returns - JSON results of the election's method
+// ============================================================================================================================
+func tally_ballots(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting tally_ballots")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := get_election(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballotType, found := ballotTypes[election_method(election)]
+	if !found {
+		return shim.Error("Unknown voting method - " + election.Method)
+	}
+
+	response := ballotType.Tally(stub, args)
+	fmt.Println("- end tally_ballots")
+	return response
+}
+
+
+// ============================================================================================================================
+// Read Marked Ballot - read the approval or score ballot of a voter
+//
+// Inputs - Array of strings
+//      0      	,	   1      	.
+//  election id	,  voter id  	.
+//	"e001"		,	"v001"		.
+//
+// Returns - JSON MarkedBallot
+// ============================================================================================================================
+func read_marked_ballot(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting read_marked_ballot")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ballot, err := get_marked_ballot(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ballotAsBytes, _ := json.Marshal(ballot)
+	fmt.Println("- end read_marked_ballot")
+	return shim.Success(ballotAsBytes)
+}
+
+
+// ============================================================================================================================
+// Read Question - read a question from ledger
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,     id 		.
+//	"e001"			,	"q001"		.
+//
+// Returns - JSON Question
+// ============================================================================================================================
+func read_question(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting read_question")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	question, err := get_question(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	questionAsBytes, _ := json.Marshal(question)
+	fmt.Println("- end read_question")
+	return shim.Success(questionAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Question Results - tally a question with its turnout and quorum
+//
+// Options keep the order they were created in. Winners holds the options other than abstain sharing the most votes.
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,  question id 	.
+//	"e001"			,	"q001"		.
+//
+// Returns - JSON QuestionResults
+// ============================================================================================================================
+func get_question_results(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var results QuestionResults
+	fmt.Println("starting get_question_results")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := get_election(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	question, err := get_question(stub, election.EID, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	results.ElectionID = election.EID
+	results.QID = question.QID
+	results.Text = question.Text
+	results.Status = election.Status
+	results.Options = []OptionResult{}
+	results.Winners = []string{}
+	var top uint64
+	for _, tally := range question.Tallies {
+		results.TotalVotes, err = add_count(results.TotalVotes, tally.Votes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if tally.Option != AbstainOption && tally.Votes > top {
+			top = tally.Votes
+		}
+	}
+	for _, tally := range question.Tallies {
+		var result OptionResult
+		result.Option = tally.Option
+		result.Votes = tally.Votes
+		if results.TotalVotes > 0 {
+			result.Percentage = float64(tally.Votes) * 100 / float64(results.TotalVotes)
+		}
+		results.Options = append(results.Options, result)
+		if tally.Option != AbstainOption && top > 0 && tally.Votes == top {
+			results.Winners = append(results.Winners, tally.Option)
+		}
+	}
+	results.Tie = len(results.Winners) > 1
+
+	// answers of voters suspended or removed since then do not count towards turnout, like the voters themselves
+	eligible, err := get_eligible_voters(stub, election.EID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	results.EligibleVoters = uint64(len(eligible))
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(AnswerObject, []string{election.EID, question.QID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keys, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if eligible[keys[2]] {
+			results.Voters++
+		}
+	}
+	if results.EligibleVoters > 0 {
+		results.Turnout = float64(results.Voters) * 100 / float64(results.EligibleVoters)
+	}
+	results.Quorum = question.Quorum
+	results.QuorumMet = results.Voters * 100 >= question.Quorum * results.EligibleVoters
+
+	resultsAsBytes, _ := json.Marshal(results)
+	fmt.Println("- end get_question_results")
+	return shim.Success(resultsAsBytes)
+}
+
+
+// ============================================================================================================================
+// Read Delegations - the delegations a voter gave and the ones it received
+//
+// Inputs - Array of strings
+//      0      	,	   1      	.
+//  election id	,  voter id  	.
+//	"e001"		,	"v001"		.
+//
+// Returns - JSON Delegations
+// ============================================================================================================================
+func read_delegations(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var delegations Delegations
+	fmt.Println("starting read_delegations")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+	err = check_voter_visible(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	delegations.Given = []Delegation{}
+	delegations.Received = []Delegation{}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(DelegationObject, []string{eid, vid})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var delegation Delegation
+		err = json.Unmarshal(queryResponse.Value, &delegation)
+		if err != nil {
+			return shim.Error("Failed to decode delegation " + queryResponse.Key + " - " + err.Error())
+		}
+		delegations.Given = append(delegations.Given, delegation)
+	}
+
+	// the index key holds the delegator and topic of every delegation received
+	indexIterator, err := stub.GetStateByPartialCompositeKey(DelegateIndex, []string{eid, vid})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer indexIterator.Close()
+	for indexIterator.HasNext() {
+		queryResponse, err := indexIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		delegation, err := get_delegation(stub, eid, keyParts[2], keyParts[3])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		delegations.Received = append(delegations.Received, delegation)
+	}
+
+	delegationsAsBytes, _ := json.Marshal(delegations)
+	fmt.Println("- end read_delegations")
+	return shim.Success(delegationsAsBytes)
+}
+
+
+// ============================================================================================================================
+// Preview Vote Cost - how many tokens transfer_vote would charge a voter for more votes on a candidate
+//
+// Inputs - Array of strings
+//      0      	,	   1      	,	   2     	,	   3    	.
+//  election id	,  voter id  	, candidate id 	,	votes 		.
+//	"e001"		,	"v001"		,	"c001"		,	"3"			.
+//
+// Returns - JSON CostPreview
+// ============================================================================================================================
+func preview_vote_cost(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var preview CostPreview
+	fmt.Println("starting preview_vote_cost")
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	eid := args[0]
+	vid := args[1]
+	cid := args[2]
+	votes, err := parse_count(args[3])
+	if err != nil || votes == 0 {
+		return shim.Error("Expecting a positive number of votes - " + args[3])
+	}
+
+	election, err := get_election(stub, eid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	voter, err := get_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_tombstone_access(stub, voter)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = get_candidate(stub, eid, cid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	preview.ElectionID = eid
+	preview.VID = vid
+	preview.CID = cid
+	preview.VoteCost = election.VoteCost
+	preview.AdditionalVotes = votes
+	preview.TokensRemaining = voter.TokensRemaining
+	preview.Cost = votes
+	if election.VoteCost == VoteCostQuadratic {
+		allocation, err := get_allocation(stub, eid, vid, cid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		preview.CurrentVotes = allocation.Votes
+		preview.TokensSpent = allocation.TokensSpent
+		preview.Cost, err = quadratic_cost(allocation.Votes, votes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	} else {
+		preview.VoteCost = VoteCostLinear
+	}
+	preview.Affordable = preview.Cost <= voter.TokensRemaining
+
+	previewAsBytes, _ := json.Marshal(preview)
+	fmt.Println("- end preview_vote_cost")
+	return shim.Success(previewAsBytes)
+}
+
+
+// ============================================================================================================================
+// Verify Invariants - scan every asset of an election and report whatever does not add up
+//
+// Each voter's paid tokens must be explained by its ballots (or quadratic allocations), sealed and forfeited
+// commitments, the escrow of its delegations and its answers. Each candidate's votes must match its ballots that were
+// not revoked, each question's tallies its answers, and every ballot must point at an existing voter and candidate.
+// Private ballots are not on the channel, so spending and tallies of private elections are not compared.
+//
+// Inputs - Array of strings
+//      0      	.
+//  election id	.
+//	"e001"		.
+//
+// Returns - JSON InvariantReport
+// ============================================================================================================================
+func verify_invariants(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var report InvariantReport
+	fmt.Println("starting verify_invariants")
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	election, err := get_election(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	eid := election.EID
+	report.ElectionID = eid
+	report.Discrepancies = []Discrepancy{}
+	report.Notes = []string{}
+
+	flag := func(kind string, id string, detail string) {
+		report.Discrepancies = append(report.Discrepancies, Discrepancy{Kind: kind, ID: id, Detail: detail})
+	}
+	add := func(total *uint64, count uint64, id string) {
+		sum, err := add_count(*total, count)
+		if err != nil {
+			flag(DiscrepancyOverflow, id, err.Error())
+			return
+		}
+		*total = sum
+	}
+	decode := func(objectType string, target func() interface{}, keep func()) error {
+		return scan_election(stub, objectType, eid, func(key string, value []byte) {
+			if err := json.Unmarshal(value, target()); err != nil {
+				flag(DiscrepancyUndecodable, key, err.Error())
+				return
+			}
+			keep()
+		})
+	}
+
+	// load everything first, the checks below cross reference it
+	var voter Voter
+	var voters []Voter
+	voterIDs := map[string]bool{}
+	err = decode(VoterObject, func() interface{} { voter = Voter{}; return &voter }, func() {
+		voters = append(voters, voter)
+		voterIDs[voter.VID] = true
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var candidate Candidate
+	var candidates []Candidate
+	candidateIDs := map[string]bool{}
+	err = decode(CandidateObject, func() interface{} { candidate = Candidate{}; return &candidate }, func() {
+		candidates = append(candidates, candidate)
+		candidateIDs[candidate.CID] = true
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	accounted := map[string]uint64{}
+	ballotVotes := map[string]uint64{}
+	ballotIDs := map[string]bool{}
+	private := election.BallotMode == BallotPrivate
+	quadratic := election.VoteCost == VoteCostQuadratic
+
+	var ballot Ballot
+	err = decode(BallotObject, func() interface{} { ballot = Ballot{}; return &ballot }, func() {
+		report.Ballots++
+		ballotIDs[ballot.BallotID] = true
+		if !voterIDs[ballot.VID] {
+			flag(DiscrepancyOrphaned, ballot.BallotID, "ballot cast by missing voter " + ballot.VID)
+		}
+		if ballot.Delegator != "" && !voterIDs[ballot.Delegator] {
+			flag(DiscrepancyOrphaned, ballot.BallotID, "ballot spending tokens of missing voter " + ballot.Delegator)
+		}
+		if !candidateIDs[ballot.CID] {
+			flag(DiscrepancyOrphaned, ballot.BallotID, "ballot for missing candidate " + ballot.CID)
+		}
+		if ballot.Revoked {
+			return
+		}
+		votes := ballot.Votes
+		if votes == 0 {
+			votes = ballot.Tokens
+		}
+		add(&report.BallotVotes, votes, ballot.BallotID)
+		if candidateIDs[ballot.CID] {
+			total := ballotVotes[ballot.CID]
+			add(&total, votes, ballot.BallotID)
+			ballotVotes[ballot.CID] = total
+		}
+		// quadratic spending is read from the allocations, refunds are not priced like the ballot
+		if quadratic {
+			return
+		}
+		payer := ballot.VID
+		if ballot.Delegator != "" {
+			payer = ballot.Delegator
+		}
+		total := accounted[payer]
+		add(&total, ballot.Tokens, ballot.BallotID)
+		accounted[payer] = total
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	spend := func(vid string, tokens uint64, id string) {
+		total := accounted[vid]
+		add(&total, tokens, id)
+		accounted[vid] = total
+	}
+	var allocation Allocation
+	err = decode(AllocationObject, func() interface{} { allocation = Allocation{}; return &allocation }, func() {
+		spend(allocation.VID, allocation.TokensSpent, allocation.VID + "/" + allocation.CID)
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var commitment Commitment
+	err = decode(CommitmentObject, func() interface{} { commitment = Commitment{}; return &commitment }, func() {
+		if commitment.Status == CommitmentSealed || commitment.Status == CommitmentForfeited {
+			spend(commitment.VID, commitment.Tokens, commitment.CommitID)
+		}
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var delegation Delegation
+	err = decode(DelegationObject, func() interface{} { delegation = Delegation{}; return &delegation }, func() {
+		spend(delegation.Delegator, delegation.Tokens, delegation.Delegator + "/" + delegation.Topic)
+		if !voterIDs[delegation.Delegate] {
+			flag(DiscrepancyOrphaned, delegation.Delegator + "/" + delegation.Topic, "delegation to missing voter " + delegation.Delegate)
+		}
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	answerTokens := map[string]uint64{}
+	answerVoters := map[string]uint64{}
+	var answer Answer
+	err = decode(AnswerObject, func() interface{} { answer = Answer{}; return &answer }, func() {
+		spend(answer.VID, answer.Tokens, answer.AnswerID)
+		option := answerTokens[answer.QID + "/" + answer.Option]
+		add(&option, answer.Tokens, answer.AnswerID)
+		answerTokens[answer.QID + "/" + answer.Option] = option
+		answerVoters[answer.QID]++
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// voters - what they paid against what their records explain
+	if private {
+		report.Notes = append(report.Notes, "private ballots are not on the channel, voter spending and candidate tallies were not compared")
+	}
+	for vid, tokens := range accounted {
+		if !voterIDs[vid] {
+			flag(DiscrepancyOrphaned, vid, strconv.FormatUint(tokens, 10) + " tokens accounted to a missing voter")
+		}
+	}
+	for _, voter := range voters {
+		report.Voters++
+		add(&report.TokensBought, voter.TokensBought, voter.VID)
+		add(&report.TokensRemaining, voter.TokensRemaining, voter.VID)
+		add(&report.TokensAccounted, accounted[voter.VID], voter.VID)
+
+		if voter.Status == VoterActive && voter.TokensRemaining == 0 {
+			flag(DiscrepancyStatus, voter.VID, "active without tokens")
+		}
+		if voter.Status == VoterExhausted && voter.TokensRemaining > 0 {
+			flag(DiscrepancyStatus, voter.VID, "exhausted with " + strconv.FormatUint(voter.TokensRemaining, 10) + " tokens")
+		}
+		if voter.TokensRemaining > voter.TokensBought {
+			flag(DiscrepancyNegativeBalance, voter.VID, strconv.FormatUint(voter.TokensRemaining, 10) + " tokens remaining out of " + strconv.FormatUint(voter.TokensBought, 10) + " bought")
+			continue
+		}
+		spent := voter.TokensBought - voter.TokensRemaining
+		add(&report.TokensSpent, spent, voter.VID)
+		if private {
+			continue
+		}
+		if accounted[voter.VID] > spent {
+			flag(DiscrepancyOverspent, voter.VID, "records account for " + strconv.FormatUint(accounted[voter.VID], 10) + " tokens, the voter paid " + strconv.FormatUint(spent, 10))
+		}
+		if accounted[voter.VID] < spent {
+			flag(DiscrepancyUnaccounted, voter.VID, "the voter paid " + strconv.FormatUint(spent, 10) + " tokens, records account for " + strconv.FormatUint(accounted[voter.VID], 10))
+		}
+	}
+
+	// candidates - votes against ballots
+	for _, candidate := range candidates {
+		report.Candidates++
+		add(&report.VotesReceived, candidate.VotesReceived, candidate.CID)
+		if !private && candidate.VotesReceived != ballotVotes[candidate.CID] {
+			flag(DiscrepancyTally, candidate.CID, strconv.FormatUint(candidate.VotesReceived, 10) + " votes received, ballots hold " + strconv.FormatUint(ballotVotes[candidate.CID], 10))
+		}
+	}
+
+	// questions - tallies against answers
+	var question Question
+	err = decode(QuestionObject, func() interface{} { question = Question{}; return &question }, func() {
+		for _, tally := range question.Tallies {
+			if tally.Votes != answerTokens[question.QID + "/" + tally.Option] {
+				flag(DiscrepancyQuestion, question.QID, "option " + tally.Option + " holds " + strconv.FormatUint(tally.Votes, 10) + " votes, answers hold " + strconv.FormatUint(answerTokens[question.QID + "/" + tally.Option], 10))
+			}
+		}
+		if question.Voters != answerVoters[question.QID] {
+			flag(DiscrepancyQuestion, question.QID, strconv.FormatUint(question.Voters, 10) + " voters counted, " + strconv.FormatUint(answerVoters[question.QID], 10) + " answers")
+		}
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ballot indexes - every entry must lead to a ballot
+	for _, index := range []string{VoterBallotIndex, CandidateBallotIndex} {
+		err = scan_election(stub, index, eid, func(key string, value []byte) {
+			_, keyParts, err := stub.SplitCompositeKey(key)
+			if err != nil || len(keyParts) != 3 || !ballotIDs[keyParts[2]] {
+				flag(DiscrepancyDanglingIndex, key, "no ballot behind " + index + " entry")
+			}
+		})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	report.Valid = len(report.Discrepancies) == 0
+	reportAsBytes, _ := json.Marshal(report)
+	fmt.Println("- end verify_invariants")
+	return shim.Success(reportAsBytes)
+}
+
+
+// ============================================================================================================================
+// List Voters - page through the voters of an election
+//
+// Filters are optional "name=value" arguments:
+//	status=active		- only voters in that status (active, exhausted, suspended, removed)
+//	min_tokens=10		- only voters with at least that many remaining tokens
+//
+// Inputs - Array of strings
+//      0      	,	   1      	,	   2     	,	   3..    				.
+//  election id	,  page size 	,  bookmark 	,	filters 				.
+//	"e001"		,	"20"		,	"" 			,	"status=active"			.
+//
+// Returns - JSON VoterPage
+// ============================================================================================================================
+func list_voters(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var page VoterPage
+	var status string
+	var minTokens uint64
+	fmt.Println("starting list_voters")
+
+	eid, pageSize, bookmark, filters, err := parse_page_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for name, value := range filters {
+		switch name {
+		case "status":
+			if _, known := voterTransitions[value]; !known {
+				err = errors.New("not a voter status")
+			}
+			status = value
+		case "enabled":                                   //kept from before voter statuses, same as status=active
+			var onlyEnabled bool
+			onlyEnabled, err = strconv.ParseBool(value)
+			if onlyEnabled {
+				status = VoterActive
+			}
+		case "min_tokens":
+			minTokens, err = parse_count(value)
+		default:
+			err = errors.New("Unknown voter filter - " + name)
+		}
+		if err != nil {
+			return shim.Error("Invalid voter filter " + name + " - " + err.Error())
+		}
+	}
+
+	// removed voters are only listed for auditors
+	identity, err := get_identity(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	showRemoved := identity.Role == RoleAuditor
+	if status == VoterRemoved && !showRemoved {
+		return shim.Error("Only auditors can list removed voters")
+	}
+
+	values, metadata, err := get_page(stub, VoterObject, eid, pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	page.Records = []Voter{}
+	page.FetchedRecordsCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+
+	for _, value := range values {
+		var voter Voter
+		err = json.Unmarshal(value, &voter)
+		if err != nil {
+			return shim.Error("Failed to decode voter")
+		}
+		if status != "" && voter.Status != status {
+			continue
+		}
+		if voter.Status == VoterRemoved && !showRemoved {
+			continue
+		}
+		if voter.TokensRemaining < minTokens {
+			continue
+		}
+		page.Records = append(page.Records, voter)
+	}
+
+	pageAsBytes, _ := json.Marshal(page)
+	fmt.Println("- end list_voters")
+	return shim.Success(pageAsBytes)
+}
+
+
+// ============================================================================================================================
+// List Candidates - page through the candidates of an election
+//
+// Filters are optional "name=value" arguments:
+//	min_votes=10		- only candidates with at least that many votes
+//
+// Inputs - Array of strings
+//      0      	,	   1      	,	   2     	,	   3..    				.
+//  election id	,  page size 	,  bookmark 	,	filters 				.
+//	"e001"		,	"20"		,	"" 			,	"min_votes=1"			.
+//
+// Returns - JSON CandidatePage
+// ============================================================================================================================
+func list_candidates(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var page CandidatePage
+	var minVotes uint64
+	fmt.Println("starting list_candidates")
+
+	eid, pageSize, bookmark, filters, err := parse_page_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for name, value := range filters {
+		switch name {
+		case "min_votes":
+			minVotes, err = parse_count(value)
+		default:
+			err = errors.New("Unknown candidate filter - " + name)
+		}
+		if err != nil {
+			return shim.Error("Invalid candidate filter " + name + " - " + err.Error())
+		}
+	}
+
+	values, metadata, err := get_page(stub, CandidateObject, eid, pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	page.Records = []Candidate{}
+	page.FetchedRecordsCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+
+	for _, value := range values {
+		var candidate Candidate
+		err = json.Unmarshal(value, &candidate)
+		if err != nil {
+			return shim.Error("Failed to decode candidate")
+		}
+		if candidate.VotesReceived < minVotes {
+			continue
+		}
+		page.Records = append(page.Records, candidate)
+	}
+
+	pageAsBytes, _ := json.Marshal(page)
+	fmt.Println("- end list_candidates")
+	return shim.Success(pageAsBytes)
+}
+
+
+// ============================================================================================================================
+// Read Commitments - every commitment of a voter
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,   voter id	.
+//	"e001"			,	"v001"		.
+//
+// Returns - JSON array of Commitment
+// ============================================================================================================================
+func read_commitments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting read_commitments")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_voter_visible(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	commitments, err := get_commitments(stub, []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	commitmentsAsBytes, _ := json.Marshal(commitments)
+	fmt.Println("- end read_commitments")
+	return shim.Success(commitmentsAsBytes)
+}
+
+
+// ============================================================================================================================
+// Read Private Vote - read a private vote back from the collection, only for the identity that claimed the voter. No
+// other role can read it, that is what keeps the ballot secret.
+//
+// Inputs - Array of strings
+//      0      		,	   1      	,	   2      	.
+//  election id		,   voter id	,	ballot id	.
+//	"e001"			,	"v001"		,	"3a1f..."	.
+//
+// Returns - JSON PrivateVote
+// ============================================================================================================================
+func read_private_vote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting read_private_vote")
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	// input sanitation, the ballot id is a transaction id and longer than the usual arguments
+	err := sanitize_arguments(args[0:2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[2]) == 0 || len(args[2]) > 64 {
+		return shim.Error("Argument 2 must be a transaction id")
+	}
+
+	voter, err := get_voter(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = check_voter_owner(stub, voter)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := stub.CreateCompositeKey(PrivateVoteObject, []string{args[0], args[1], args[2]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	privateVoteAsBytes, err := stub.GetPrivateData(PrivateCollection, key)
+	if err != nil {
+		return shim.Error("Failed to get private vote - " + err.Error())
+	}
+	if privateVoteAsBytes == nil {
+		return shim.Error("Private vote does not exist - " + args[2])
+	}
+
+	fmt.Println("- end read_private_vote")
+	return shim.Success(privateVoteAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Receipts - every token purchase of a voter
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,   voter id	.
+//	"e001"			,	"v001"		.
+//
+// Returns - JSON array of Receipt
+// ============================================================================================================================
+func get_receipts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	receipts := []Receipt{}
+	fmt.Println("starting get_receipts")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_voter_visible(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(ReceiptObject, []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var receipt Receipt
+		err = json.Unmarshal(kv.Value, &receipt)
+		if err != nil {
+			return shim.Error("Failed to decode receipt - " + kv.Key)
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	receiptsAsBytes, _ := json.Marshal(receipts)
+	fmt.Println("- end get_receipts")
+	return shim.Success(receiptsAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Ballots By Voter - every ballot a voter cast in an election
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,   voter id	.
+//	"e001"			,	"v001"		.
+//
+// Returns - JSON array of Ballot
+// ============================================================================================================================
+func get_ballots_by_voter(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return get_ballots_by_index(stub, args, VoterBallotIndex)
+}
+
+
+// ============================================================================================================================
+// Get Ballots By Candidate - every ballot cast for a candidate in an election
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,  candidate id	.
+//	"e001"			,	"c001"		.
+//
+// Returns - JSON array of Ballot
+// ============================================================================================================================
+func get_ballots_by_candidate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return get_ballots_by_index(stub, args, CandidateBallotIndex)
+}
+
+
+// ============================================================================================================================
+// Get Ballots By Index - walk a ballot index for [election, voter or candidate] and load every ballot it points at
+// ============================================================================================================================
+func get_ballots_by_index(stub shim.ChaincodeStubInterface, args []string, index string) pb.Response {
+	ballots := []Ballot{}
+	fmt.Println("starting get_ballots_by_index, " + index)
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if index == VoterBallotIndex {
+		err = check_voter_visible(stub, args[0], args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(index, []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keys, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		ballot, err := get_ballot(stub, args[0], keys[2])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		ballots = append(ballots, ballot)
+	}
+
+	ballotsAsBytes, _ := json.Marshal(ballots)
+	fmt.Println("- end get_ballots_by_index")
+	return shim.Success(ballotsAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Voter History - every change of a voter, most recent first
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,   voter id	.
+//	"e001"			,	"v001"		.
+//
+// Returns - JSON array of HistoryEntry holding Voter values
+// ============================================================================================================================
+func get_voter_history(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_voter_history")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the history holds the removal too
+	err = check_voter_visible(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := voter_key(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	history, err := get_history(stub, key, func(value []byte) (interface{}, error) {
+		var voter Voter
+		err := json.Unmarshal(value, &voter)
+		return voter, err
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	historyAsBytes, _ := json.Marshal(history)
+	fmt.Println("- end get_voter_history")
+	return shim.Success(historyAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Candidate History - every change of a candidate, most recent first
+//
+// Inputs - Array of strings
+//      0      		,	   1      	.
+//  election id		,  candidate id	.
+//	"e001"			,	"c001"		.
+//
+// Returns - JSON array of HistoryEntry holding Candidate values
+// ============================================================================================================================
+func get_candidate_history(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting get_candidate_history")
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := candidate_key(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	history, err := get_history(stub, key, func(value []byte) (interface{}, error) {
+		var candidate Candidate
+		err := json.Unmarshal(value, &candidate)
+		return candidate, err
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	historyAsBytes, _ := json.Marshal(history)
+	fmt.Println("- end get_candidate_history")
+	return shim.Success(historyAsBytes)
+}
+
+
+//*********************************************************************************
+//********************************** LIB ******************************************
+//*********************************************************************************
+// ============================================================================================================================
+// Voter Key - voters are stored under a composite key scoped to their election, so the same
+// voter id can hold a separate token balance in every election
+// ============================================================================================================================
+func voter_key(stub shim.ChaincodeStubInterface, eid string, vid string) (string, error) {
+	return stub.CreateCompositeKey(VoterObject, []string{eid, vid})
+}
+
+
+// ============================================================================================================================
+// Candidate Key - candidates are stored under a composite key scoped to their election
+// ============================================================================================================================
+func candidate_key(stub shim.ChaincodeStubInterface, eid string, cid string) (string, error) {
+	return stub.CreateCompositeKey(CandidateObject, []string{eid, cid})
+}
+
+
+// ============================================================================================================================
+// Election Key - elections live in their own namespace so they can never collide with voters or candidates
+// ============================================================================================================================
+func election_key(stub shim.ChaincodeStubInterface, eid string) (string, error) {
+	return stub.CreateCompositeKey(ElectionObject, []string{eid})
+}
+
+
+// ============================================================================================================================
+// Is Not Found - whether a get_ function failed only because nothing is stored under the key
+// ============================================================================================================================
+func is_not_found(err error) bool {
+	_, ok := err.(notFoundError)
+	return ok
+}
+
+
+// ============================================================================================================================
+// Get Voter - get a voter asset of an election from ledger
+//
+// ============================================================================================================================
+func get_voter(stub shim.ChaincodeStubInterface, eid string, vid string) (Voter, error) {
+	var voter Voter
+	key, err := voter_key(stub, eid, vid)
+	if err != nil {
+		return voter, err
+	}
+	voterAsBytes, err := stub.GetState(key) //getState retreives a key/value from the ledger. If the key does not exist in the state database, (nil, nil) is returned.
+
+	if err != nil {                                          
+		return voter, errors.New("Failed to find voter - " + vid)
+	}
+	if voterAsBytes == nil {
+		return voter, notFoundError("Voter does not exist - " + vid)
+	}
+	err = json.Unmarshal(voterAsBytes, &voter) //un stringify it aka JSON.parse()
+	if err != nil {
+		return voter, errors.New("Failed to decode voter " + vid + " - " + err.Error())
+	}
+
+	if voter.ObjectType != VoterObject || voter.VID != vid {  
+		return voter, errors.New("Voter stored under the wrong key - " + vid)
+	}
+
+	return voter, nil
+}
+
+
+// ============================================================================================================================
+// Get Active Voter - get a voter for its owner to act on. Suspended and removed voters can not act at all. Exhausted
+// voters can still revoke and reveal, the callers that spend tokens check for VoterActive themselves.
+// ============================================================================================================================
+func get_active_voter(stub shim.ChaincodeStubInterface, eid string, vid string) (Voter, error) {
+	voter, err := get_voter(stub, eid, vid)
+	if err != nil {
+		return voter, err
+	}
+	if voter.Status == VoterSuspended || voter.Status == VoterRemoved {
+		return voter, errors.New("This voter is " + voter.Status + " - " + vid)
+	}
+	err = check_voter_owner(stub, voter)
+	if err != nil {
+		return voter, err
+	}
+	return voter, nil
+}
+
+
+// ============================================================================================================================
+// Put Voter - store a voter asset into the ledger under its election
+// ============================================================================================================================
+func put_voter(stub shim.ChaincodeStubInterface, voter Voter) error {
+	key, err := voter_key(stub, voter.ElectionID, voter.VID)
+	if err != nil {
+		return err
+	}
+	voter.ObjectType = VoterObject
+	voterAsBytes, _ := json.Marshal(voter)                         //convert to array of bytes
+	return stub.PutState(key, voterAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Canddidate - get a candidate asset of an election from ledger
+// ============================================================================================================================
+func get_candidate(stub shim.ChaincodeStubInterface, eid string, cid string) (Candidate, error) {
+	var candidate Candidate
+	key, err := candidate_key(stub, eid, cid)
+	if err != nil {
+		return candidate, err
+	}
+	candidateAsBytes, err := stub.GetState(key) //getState retreives a key/value from the ledger. If the key does not exist in the state database, (nil, nil) is returned.
+
+	if err != nil {             
+		return candidate, errors.New("Failed to find candidate - " + cid)
+	}
+	if candidateAsBytes == nil {
+		return candidate, notFoundError("Candidate does not exist - " + cid)
+	}
+	err = json.Unmarshal(candidateAsBytes, &candidate) //un stringify it aka JSON.parse()
+	if err != nil {
+		return candidate, errors.New("Failed to decode candidate " + cid + " - " + err.Error())
+	}
+
+	if candidate.ObjectType != CandidateObject || candidate.CID != cid {
+		return candidate, errors.New("Candidate stored under the wrong key - " + cid) 
+	}
+
+	return candidate, nil
+}
+
+
+// ============================================================================================================================
+// Put Candidate - store a candidate asset into the ledger under its election
+// ============================================================================================================================
+func put_candidate(stub shim.ChaincodeStubInterface, candidate Candidate) error {
+	key, err := candidate_key(stub, candidate.ElectionID, candidate.CID)
+	if err != nil {
+		return err
+	}
+	candidate.ObjectType = CandidateObject
+	candidateAsBytes, _ := json.Marshal(candidate)                         //convert to array of bytes
+	return stub.PutState(key, candidateAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Question - get a question asset from ledger
+// ============================================================================================================================
+func get_question(stub shim.ChaincodeStubInterface, eid string, qid string) (Question, error) {
+	var question Question
+	key, err := stub.CreateCompositeKey(QuestionObject, []string{eid, qid})
+	if err != nil {
+		return question, err
+	}
+	questionAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return question, errors.New("Failed to find question - " + qid)
+	}
+	if questionAsBytes == nil {
+		return question, notFoundError("Question does not exist - " + qid)
+	}
+	err = json.Unmarshal(questionAsBytes, &question)
+	if err != nil {
+		return question, errors.New("Failed to decode question " + qid + " - " + err.Error())
+	}
+	return question, nil
+}
+
+
+// ============================================================================================================================
+// Put Question - store a question asset into the ledger
+// ============================================================================================================================
+func put_question(stub shim.ChaincodeStubInterface, question Question) error {
+	key, err := stub.CreateCompositeKey(QuestionObject, []string{question.ElectionID, question.QID})
+	if err != nil {
+		return err
+	}
+	question.ObjectType = QuestionObject
+	questionAsBytes, _ := json.Marshal(question)
+	return stub.PutState(key, questionAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Eligible Voters - ids of the voters of an election that may vote or have voted, suspended and removed ones are
+// left out
+// ============================================================================================================================
+func get_eligible_voters(stub shim.ChaincodeStubInterface, eid string) (map[string]bool, error) {
+	eligible := map[string]bool{}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(VoterObject, []string{eid})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var voter Voter
+		err = json.Unmarshal(kv.Value, &voter)
+		if err != nil {
+			return nil, errors.New("Failed to decode voter - " + kv.Key)
+		}
+		if voter.Status == VoterActive || voter.Status == VoterExhausted {
+			eligible[voter.VID] = true
+		}
+	}
+	return eligible, nil
+}
+
+
+// ============================================================================================================================
+// Get All Candidates - range scan every candidate of an election
+// ============================================================================================================================
+func get_all_candidates(stub shim.ChaincodeStubInterface, eid string) ([]Candidate, error) {
+	var candidates []Candidate
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(CandidateObject, []string{eid})
+	if err != nil {
+		return candidates, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return candidates, err
+		}
+		var candidate Candidate
+		err = json.Unmarshal(kv.Value, &candidate)
+		if err != nil {
+			return candidates, errors.New("Failed to decode candidate - " + kv.Key)
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+
+// ============================================================================================================================
+// Scan Election - call visit with the key and value of every asset of a type in an election, in key order
+// ============================================================================================================================
+func scan_election(stub shim.ChaincodeStubInterface, objectType string, eid string, visit func(string, []byte)) error {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(objectType, []string{eid})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		visit(kv.Key, kv.Value)
+	}
+	return nil
+}
+
+
+// ============================================================================================================================
+// Get Page - fetch one page of the assets of an election, using the ledger's bookmark based pagination
+// ============================================================================================================================
+func get_page(stub shim.ChaincodeStubInterface, objectType string, eid string, pageSize int32, bookmark string) ([][]byte, *pb.QueryResponseMetadata, error) {
+	var values [][]byte
+	resultsIterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(objectType, []string{eid}, pageSize, bookmark)
+	if err != nil {
+		return values, metadata, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return values, metadata, err
+		}
+		values = append(values, kv.Value)
+	}
+	return values, metadata, nil
+}
+
+
+// ============================================================================================================================
+// Parse Page Arguments - election id, page size (capped to MaxPageSize), bookmark and "name=value" filters
+// ============================================================================================================================
+func parse_page_arguments(args []string) (string, int32, string, map[string]string, error) {
+	filters := map[string]string{}
+
+	if len(args) < 3 {
+		return "", 0, "", filters, errors.New("Incorrect number of arguments. Expecting election id, page size, bookmark and optional filters")
+	}
+
+	// the bookmark is empty on the first page and is a ledger key after that, so it is not sanitized
+	err := sanitize_arguments(args[0:2])
+	if err == nil {
+		err = sanitize_arguments(args[3:])
+	}
+	if err != nil {
+		return "", 0, "", filters, err
+	}
+
+	pageSize, err := strconv.Atoi(args[1])
+	if err != nil || pageSize <= 0 {
+		return "", 0, "", filters, errors.New("Page size must be a positive number - " + args[1])
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	for _, filter := range args[3:] {
+		pair := strings.SplitN(filter, "=", 2)
+		if len(pair) != 2 {
+			return "", 0, "", filters, errors.New("Filters must look like name=value - " + filter)
+		}
+		filters[pair[0]] = pair[1]
+	}
+
+	return args[0], int32(pageSize), args[2], filters, nil
+}
+
+
+// ============================================================================================================================
+// Get History - walk the ledger history of a key, decoding every value that is not a delete. The shim returns the
+// oldest modification first, the entries are sorted most recent first.
+// ============================================================================================================================
+func get_history(stub shim.ChaincodeStubInterface, key string, decode func([]byte) (interface{}, error)) ([]HistoryEntry, error) {
+	history := []HistoryEntry{}
+	resultsIterator, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return history, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return history, err
+		}
+
+		var entry HistoryEntry
+		entry.TxID = modification.TxId
+		entry.IsDelete = modification.IsDelete
+		if modification.Timestamp != nil {
+			entry.Timestamp = format_timestamp(modification.Timestamp.Seconds, modification.Timestamp.Nanos)
+			entry.unixNano = time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UnixNano()
+		}
+		if !modification.IsDelete {
+			entry.Value, err = decode(modification.Value)
+			if err != nil {
+				return history, errors.New("Failed to decode the value written by " + modification.TxId + " - " + err.Error())
+			}
+		}
+		history = append(history, entry)
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].unixNano > history[j].unixNano
+	})
+	return history, nil
+}
+
+
+// ============================================================================================================================
+// Get Ballot - get a ballot asset from ledger
+// ============================================================================================================================
+func get_ballot(stub shim.ChaincodeStubInterface, eid string, ballotID string) (Ballot, error) {
+	var ballot Ballot
+	key, err := stub.CreateCompositeKey(BallotObject, []string{eid, ballotID})
+	if err != nil {
+		return ballot, err
+	}
+	ballotAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return ballot, errors.New("Failed to find ballot - " + ballotID)
+	}
+	if ballotAsBytes == nil {
+		return ballot, errors.New("Ballot does not exist - " + ballotID)
+	}
+	err = json.Unmarshal(ballotAsBytes, &ballot)
+	if err != nil {
+		return ballot, errors.New("Failed to decode ballot " + ballotID + " - " + err.Error())
+	}
+	return ballot, nil
+}
+
+
+// ============================================================================================================================
+// Put Ballot - store a ballot along with its voter and candidate index entries
+// ============================================================================================================================
+func put_ballot(stub shim.ChaincodeStubInterface, ballot Ballot) error {
+	key, err := stub.CreateCompositeKey(BallotObject, []string{ballot.ElectionID, ballot.BallotID})
+	if err != nil {
+		return err
+	}
+	ballot.ObjectType = BallotObject
+	ballotAsBytes, _ := json.Marshal(ballot)
+	err = stub.PutState(key, ballotAsBytes)
+	if err != nil {
+		return err
+	}
+
+	// the index entries only need the key, save a marker as the value
+	value := []byte{0x00}
+	key, err = stub.CreateCompositeKey(VoterBallotIndex, []string{ballot.ElectionID, ballot.VID, ballot.BallotID})
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(key, value)
+	if err != nil {
+		return err
+	}
+	// a delegated ballot is also listed with the ballots of the voter whose tokens it spent
+	if ballot.Delegator != "" {
+		key, err = stub.CreateCompositeKey(VoterBallotIndex, []string{ballot.ElectionID, ballot.Delegator, ballot.BallotID})
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	key, err = stub.CreateCompositeKey(CandidateBallotIndex, []string{ballot.ElectionID, ballot.CID, ballot.BallotID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, value)
+}
+
+
+// ============================================================================================================================
+// Record Ballot - write the ballot of the current transaction
+// ============================================================================================================================
+func record_ballot(stub shim.ChaincodeStubInterface, eid string, vid string, cid string, tokens uint64, votes uint64, delegator string) (Ballot, error) {
+	var ballot Ballot
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return ballot, err
+	}
+
+	ballot.BallotID = stub.GetTxID()
+	ballot.ElectionID = eid
+	ballot.VID = vid
+	ballot.CID = cid
+	ballot.Tokens = tokens
+	ballot.Votes = votes
+	ballot.Delegator = delegator
+	ballot.CastAt = now
+	return ballot, put_ballot(stub, ballot)
+}
+
+
+// ============================================================================================================================
+// Get Ranked Ballot - get the ranked ballot of a voter from ledger
+// ============================================================================================================================
+func get_ranked_ballot(stub shim.ChaincodeStubInterface, eid string, vid string) (RankedBallot, error) {
+	var ballot RankedBallot
+	key, err := stub.CreateCompositeKey(RankedBallotObject, []string{eid, vid})
+	if err != nil {
+		return ballot, err
+	}
+	ballotAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return ballot, errors.New("Failed to find ranked ballot of " + vid)
+	}
+	if ballotAsBytes == nil {
+		return ballot, errors.New("Ranked ballot does not exist - " + vid)
+	}
+	err = json.Unmarshal(ballotAsBytes, &ballot)
+	if err != nil {
+		return ballot, errors.New("Failed to decode ranked ballot of " + vid + " - " + err.Error())
+	}
+	return ballot, nil
+}
+
+
+// ============================================================================================================================
+// Get Ranked Ballots - get every ranked ballot of an election, in voter id order
+// ============================================================================================================================
+func get_ranked_ballots(stub shim.ChaincodeStubInterface, eid string) ([]RankedBallot, error) {
+	var ballots []RankedBallot
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(RankedBallotObject, []string{eid})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var ballot RankedBallot
+		err = json.Unmarshal(queryResponse.Value, &ballot)
+		if err != nil {
+			return nil, errors.New("Failed to decode ranked ballot " + queryResponse.Key + " - " + err.Error())
+		}
+		ballots = append(ballots, ballot)
+	}
+	return ballots, nil
+}
+
+
+// ============================================================================================================================
+// Entry Points - a ballot type delegating to existing functions
+// ============================================================================================================================
+func (e entryPoints) Cast(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return e.cast(stub, args)
+}
+
+func (e entryPoints) Tally(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return e.tally(stub, args)
+}
+
+
+// ============================================================================================================================
+// Mark Ballots Cast - validate and store the marked ballot of a voter, one per voter
+// ============================================================================================================================
+func (m markBallots) Cast(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var ballot MarkedBallot
+	fmt.Println("starting cast " + m.method + " ballot")
+
+	eid := args[0]
+	vid := args[1]
+
+	election, err := check_election_status(stub, eid, ElectionOpen)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if election.Method != m.method {
+		return shim.Error("Election '" + eid + "' does not use " + m.method + " ballots")
+	}
+
+	marks, err := m.parse(args[2:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, mark := range marks {
+		_, err = get_running_candidate(stub, eid, mark.CID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	voter, err := get_active_voter(stub, eid, vid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if voter.Status != VoterActive {
+		return shim.Error("This voter is " + voter.Status + " - " + vid)
+	}
+
+	_, err = get_marked_ballot(stub, eid, vid)
+	if err == nil {
+		return shim.Error("This voter has already cast a ballot - " + vid)
+	}
+
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ballot.ObjectType = MarkedBallotObject
+	ballot.BallotID = stub.GetTxID()
+	ballot.ElectionID = eid
+	ballot.VID = vid
+	ballot.Method = m.method
+	ballot.Marks = marks
+	ballot.CastAt = now
+
+	key, err := stub.CreateCompositeKey(MarkedBallotObject, []string{eid, vid})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ballotAsBytes, _ := json.Marshal(ballot)
+	err = stub.PutState(key, ballotAsBytes)
+	if err != nil {
+		fmt.Println("Could not store " + m.method + " ballot")
+		return shim.Error(err.Error())
+	}
+
+	err = emit_event(stub, EventBallotCast, eid, ballot)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end cast " + m.method + " ballot")
+	return shim.Success([]byte(ballot.BallotID))
+}
+
+
+// ============================================================================================================================
+// Mark Ballots Tally - sum the marks of every candidate, highest total first (ties broken by candidate id)
+// ============================================================================================================================
+func (m markBallots) Tally(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var results MarkResults
+	fmt.Println("starting tally " + m.method + " ballots")
+
+	election, err := get_election(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	candidates, err := get_all_candidates(stub, election.EID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	position := map[string]int{}
+	results.Candidates = []MarkTally{}
+	for _, candidate := range candidates {
+		if candidate.Status == CandidateWithdrawn {
+			continue
+		}
+		position[candidate.CID] = len(results.Candidates)
+		results.Candidates = append(results.Candidates, MarkTally{CID: candidate.CID, CandidateName: candidate.CandidateName})
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(MarkedBallotObject, []string{election.EID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var ballot MarkedBallot
+		err = json.Unmarshal(queryResponse.Value, &ballot)
+		if err != nil {
+			return shim.Error("Failed to decode ballot " + queryResponse.Key + " - " + err.Error())
+		}
+		results.Ballots++
+
+		// marks for candidates that withdrew or no longer exist are not counted
+		for _, mark := range ballot.Marks {
+			i, found := position[mark.CID]
+			if !found {
+				continue
+			}
+			results.Candidates[i].Total, err = add_count(results.Candidates[i].Total, mark.Value)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			results.Candidates[i].Marks++
+		}
+	}
+
+	sort.SliceStable(results.Candidates, func(i, j int) bool {
+		if results.Candidates[i].Total != results.Candidates[j].Total {
+			return results.Candidates[i].Total > results.Candidates[j].Total
+		}
+		return results.Candidates[i].CID < results.Candidates[j].CID
+	})
+
+	results.ElectionID = election.EID
+	results.Status = election.Status
+	results.Method = m.method
+	results.Winners = []string{}
+	for _, tally := range results.Candidates {
+		if tally.Total > 0 && tally.Total == results.Candidates[0].Total {
+			results.Winners = append(results.Winners, tally.CID)
+		}
+	}
+	results.Tie = len(results.Winners) > 1
+
+	resultsAsBytes, _ := json.Marshal(results)
+	fmt.Println("- end tally " + m.method + " ballots")
+	return shim.Success(resultsAsBytes)
+}
+
+
+// ============================================================================================================================
+// Parse Approval - an approval ballot lists the approved candidates, each once
+// ============================================================================================================================
+func parse_approval(content []string) ([]Mark, error) {
+	var marks []Mark
+	approved := map[string]bool{}
+	for _, cid := range content {
+		if approved[cid] {
+			return nil, errors.New("A candidate can only be approved once - " + cid)
+		}
+		approved[cid] = true
+		marks = append(marks, Mark{CID: cid, Value: 1})
+	}
+	return marks, nil
+}
+
+
+// ============================================================================================================================
+// Parse Score - a score ballot lists "candidate id=score" pairs, each candidate once with a score from 0 to MaxScore
+// ============================================================================================================================
+func parse_score(content []string) ([]Mark, error) {
+	var marks []Mark
+	scored := map[string]bool{}
+	for _, entry := range content {
+		pair := strings.SplitN(entry, "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return nil, errors.New("Scores must look like candidate=score - " + entry)
+		}
+		score, err := parse_count(pair[1])
+		if err != nil || score > MaxScore {
+			return nil, errors.New("Scores go from 0 to " + strconv.Itoa(MaxScore) + " - " + entry)
+		}
+		if scored[pair[0]] {
+			return nil, errors.New("A candidate can only be scored once - " + pair[0])
+		}
+		scored[pair[0]] = true
+		marks = append(marks, Mark{CID: pair[0], Value: score})
+	}
+	return marks, nil
+}
+
+
+// ============================================================================================================================
+// Get Marked Ballot - get the approval or score ballot of a voter from ledger
+// ============================================================================================================================
+func get_marked_ballot(stub shim.ChaincodeStubInterface, eid string, vid string) (MarkedBallot, error) {
+	var ballot MarkedBallot
+	key, err := stub.CreateCompositeKey(MarkedBallotObject, []string{eid, vid})
+	if err != nil {
+		return ballot, err
+	}
+	ballotAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return ballot, errors.New("Failed to find ballot of " + vid)
+	}
+	if ballotAsBytes == nil {
+		return ballot, errors.New("Ballot does not exist - " + vid)
+	}
+	err = json.Unmarshal(ballotAsBytes, &ballot)
+	if err != nil {
+		return ballot, errors.New("Failed to decode ballot of " + vid + " - " + err.Error())
+	}
+	return ballot, nil
+}
+
+
+// ============================================================================================================================
+// Run IRV - instant runoff over the given candidates, see tally_irv. Preferences for unknown candidates are skipped.
+// ============================================================================================================================
+func run_irv(cids []string, rankings [][]string) ([]IRVRound, string) {
+	rounds := []IRVRound{}
+	continuing := map[string]bool{}
+	for _, cid := range cids {
+		continuing[cid] = true
+	}
+	var firstPreferences map[string]uint64
+
+	for round := 1; len(continuing) > 0; round++ {
+		var current IRVRound
+		current.Round = round
+
+		counts := map[string]uint64{}
+		for cid := range continuing {
+			counts[cid] = 0
+		}
+		for _, ranking := range rankings {
+			counted := false
+			for _, cid := range ranking {
+				if continuing[cid] {
+					counts[cid]++
+					counted = true
+					break
+				}
+			}
+			if !counted {
+				current.Exhausted++
+			}
+		}
+		if firstPreferences == nil {
+			firstPreferences = counts
+		}
+
+		for cid, votes := range counts {
+			current.Tallies = append(current.Tallies, RoundTally{CID: cid, Votes: votes})
+		}
+		sort.Slice(current.Tallies, func(i, j int) bool {
+			if current.Tallies[i].Votes != current.Tallies[j].Votes {
+				return current.Tallies[i].Votes > current.Tallies[j].Votes
+			}
+			return current.Tallies[i].CID < current.Tallies[j].CID
+		})
+
+		// nobody can be elected once no ballot counts any more
+		active := uint64(len(rankings)) - current.Exhausted
+		if active == 0 {
+			rounds = append(rounds, current)
+			return rounds, ""
+		}
+
+		top := current.Tallies[0]
+		if top.Votes * 2 > active {
+			current.Elected = top.CID
+			rounds = append(rounds, current)
+			return rounds, top.CID
+		}
+
+		current.Eliminated, current.TieBreak = pick_eliminated(current.Tallies, firstPreferences)
+		delete(continuing, current.Eliminated)
+		rounds = append(rounds, current)
+	}
+	return rounds, ""
+}
+
+
+// ============================================================================================================================
+// Run STV - single transferable vote over the given candidates, see tally_stv. Quota is in units of 1/STVScale ballot.
+// ============================================================================================================================
+func run_stv(cids []string, rankings [][]string, seats uint64, quota uint64) ([]STVRound, []string, error) {
+	rounds := []STVRound{}
+	elected := []string{}
+	if len(rankings) == 0 {
+		return rounds, elected, nil
+	}
+
+	continuing := map[string]bool{}
+	for _, cid := range cids {
+		continuing[cid] = true
+	}
+	weights := make([]uint64, len(rankings))
+	for i := range weights {
+		weights[i] = STVScale
+	}
+	var firstPreferences map[string]uint64
+	var err error
+
+	for round := 1; len(continuing) > 0 && uint64(len(elected)) < seats; round++ {
+		var current STVRound
+		current.Round = round
+
+		// every ballot counts at its weight for its most preferred continuing candidate
+		counts := map[string]uint64{}
+		for cid := range continuing {
+			counts[cid] = 0
+		}
+		holders := make([]string, len(rankings))
+		for i, ranking := range rankings {
+			for _, cid := range ranking {
+				if continuing[cid] {
+					holders[i] = cid
+					break
+				}
+			}
+			if holders[i] == "" {
+				current.Exhausted, err = add_count(current.Exhausted, weights[i])
+			} else {
+				counts[holders[i]], err = add_count(counts[holders[i]], weights[i])
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if firstPreferences == nil {
+			firstPreferences = counts
+		}
+
+		for cid, votes := range counts {
+			current.Tallies = append(current.Tallies, RoundTally{CID: cid, Votes: votes})
+		}
+		sort.Slice(current.Tallies, func(i, j int) bool {
+			if current.Tallies[i].Votes != current.Tallies[j].Votes {
+				return current.Tallies[i].Votes > current.Tallies[j].Votes
+			}
+			return current.Tallies[i].CID < current.Tallies[j].CID
+		})
+
+		// the continuing candidates fill the seats left, elect them all
+		if uint64(len(elected) + len(continuing)) <= seats {
+			for _, tally := range current.Tallies {
+				current.Elected = append(current.Elected, tally.CID)
+			}
+			elected = append(elected, current.Elected...)
+			rounds = append(rounds, current)
+			break
+		}
+
+		top := current.Tallies[0]
+		if top.Votes >= quota {
+			// the surplus moves on with every ballot held by the elected candidate
+			current.Elected = []string{top.CID}
+			current.Surplus = top.Votes - quota
+			for i, holder := range holders {
+				if holder != top.CID {
+					continue
+				}
+				weights[i], err = mul_count(weights[i], current.Surplus)
+				if err != nil {
+					return nil, nil, err
+				}
+				weights[i] = weights[i] / top.Votes
+			}
+			elected = append(elected, top.CID)
+			delete(continuing, top.CID)
+		} else {
+			current.Eliminated, current.TieBreak = pick_eliminated(current.Tallies, firstPreferences)
+			delete(continuing, current.Eliminated)
+		}
+		rounds = append(rounds, current)
+	}
+	return rounds, elected, nil
+}
+
+
+// ============================================================================================================================
+// STV Quota - votes needed to be elected, in units of 1/STVScale ballot
+// ============================================================================================================================
+func stv_quota(ballots uint64, seats uint64, method string) (uint64, error) {
+	if method == QuotaHare {
+		total, err := mul_count(ballots, STVScale)
+		if err != nil {
+			return 0, err
+		}
+		return total / seats, nil
+	}
+	return mul_count(ballots / (seats + 1) + 1, STVScale)
+}
+
+
+// ============================================================================================================================
+// Pick Eliminated - the candidate to eliminate from tallies sorted by votes, highest first
+//
+// Among the candidates sharing the fewest votes the one with fewer first preferences goes, then the one whose id sorts
+// last. The second value tells whether several candidates shared the fewest votes.
+// ============================================================================================================================
+func pick_eliminated(tallies []RoundTally, firstPreferences map[string]uint64) (string, bool) {
+	last := tallies[len(tallies) - 1]
+	eliminated := last
+	tieBreak := false
+	for _, tally := range tallies {
+		if tally.Votes != last.Votes || tally.CID == eliminated.CID {
+			continue
+		}
+		tieBreak = true
+		if firstPreferences[tally.CID] < firstPreferences[eliminated.CID] ||
+			(firstPreferences[tally.CID] == firstPreferences[eliminated.CID] && tally.CID > eliminated.CID) {
+			eliminated = tally
+		}
+	}
+	return eliminated.CID, tieBreak
+}
+
+
+// ============================================================================================================================
+// Get Delegation - get the delegation of a voter for a topic from ledger
+// ============================================================================================================================
+func get_delegation(stub shim.ChaincodeStubInterface, eid string, vid string, topic string) (Delegation, error) {
+	var delegation Delegation
+	key, err := stub.CreateCompositeKey(DelegationObject, []string{eid, vid, topic})
+	if err != nil {
+		return delegation, err
+	}
+	delegationAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return delegation, errors.New("Failed to find delegation of " + vid + " for " + topic)
+	}
+	if delegationAsBytes == nil {
+		return delegation, notFoundError("Delegation does not exist - " + vid + " for " + topic)
+	}
+	err = json.Unmarshal(delegationAsBytes, &delegation)
+	if err != nil {
+		return delegation, errors.New("Failed to decode delegation of " + vid + " for " + topic + " - " + err.Error())
+	}
+	return delegation, nil
+}
+
+
+// ============================================================================================================================
+// Find Delegation - the delegation of a voter that applies to a candidate, the one for the candidate itself or else
+// the one for any candidate
+// ============================================================================================================================
+func find_delegation(stub shim.ChaincodeStubInterface, eid string, vid string, cid string) (Delegation, bool, error) {
+	topics := []string{cid, AnyTopic}
+	if cid == AnyTopic {
+		topics = []string{AnyTopic}
+	}
+	for _, topic := range topics {
+		key, err := stub.CreateCompositeKey(DelegationObject, []string{eid, vid, topic})
+		if err != nil {
+			return Delegation{}, false, err
+		}
+		delegationAsBytes, err := stub.GetState(key)
+		if err != nil {
+			return Delegation{}, false, err
+		}
+		if delegationAsBytes != nil {
+			delegation, err := get_delegation(stub, eid, vid, topic)
+			return delegation, err == nil, err
+		}
+	}
+	return Delegation{}, false, nil
+}
+
+
+// ============================================================================================================================
+// Follow Delegations - the voters the delegations of a topic lead through, starting with vid. The last one has not
+// delegated the topic and is the one spending the tokens. Cycles and chains past MaxDelegationDepth are errors.
+// ============================================================================================================================
+func follow_delegations(stub shim.ChaincodeStubInterface, eid string, vid string, topic string) ([]string, error) {
+	chain := []string{vid}
+	for {
+		delegation, found, err := find_delegation(stub, eid, chain[len(chain) - 1], topic)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return chain, nil
+		}
+		for _, link := range chain {
+			if link == delegation.Delegate {
+				return nil, errors.New("Delegations of " + topic + " form a cycle through " + strings.Join(chain, " > "))
+			}
+		}
+		chain = append(chain, delegation.Delegate)
+		if len(chain) > MaxDelegationDepth + 1 {
+			return nil, errors.New("Delegations of " + topic + " go further than " + strconv.Itoa(MaxDelegationDepth) + " voters from " + vid)
+		}
+	}
+}
+
+
+// ============================================================================================================================
+// Check Delegation Chains - make sure a new delegation from vid to delegate creates no cycle and no chain longer than
+// MaxDelegationDepth. A specific topic only changes the chains of that candidate. "*" changes the chains of every
+// candidate vid has not delegated on its own, so those are checked as "*" plus every specific topic in use, since
+// delegations for them upstream or downstream can lead through vid.
+// ============================================================================================================================
+func check_delegation_chains(stub shim.ChaincodeStubInterface, eid string, vid string, delegate string, topic string) error {
+	topics := []string{topic}
+	if topic == AnyTopic {
+		seen := map[string]bool{AnyTopic: true}
+		resultsIterator, err := stub.GetStateByPartialCompositeKey(DelegationObject, []string{eid})
+		if err != nil {
+			return err
+		}
+		defer resultsIterator.Close()
+		for resultsIterator.HasNext() {
+			kv, err := resultsIterator.Next()
+			if err != nil {
+				return err
+			}
+			_, keys, err := stub.SplitCompositeKey(kv.Key)
+			if err != nil {
+				return err
+			}
+			if !seen[keys[2]] {
+				seen[keys[2]] = true
+				topics = append(topics, keys[2])
+			}
+		}
+	}
+
+	for _, cid := range topics {
+		// vid's own delegation for the candidate takes precedence over "*"
+		if cid != topic {
+			_, err := get_delegation(stub, eid, vid, cid)
+			if err == nil {
+				continue
+			}
+		}
+
+		// the chain the tokens would travel, starting at the delegate
+		chain, err := follow_delegations(stub, eid, delegate, cid)
+		if err != nil {
+			return err
+		}
+		for _, link := range chain {
+			if link == vid {
+				return errors.New("Delegating to " + delegate + " would form a cycle through " + strings.Join(chain, " > ") + " for " + cid)
+			}
+		}
+
+		// and the voters whose tokens already reach vid
+		above, err := delegation_depth_above(stub, eid, vid, cid, MaxDelegationDepth - len(chain))
+		if err != nil {
+			return err
+		}
+		if above + len(chain) > MaxDelegationDepth {
+			return errors.New("Delegating to " + delegate + " would make a chain for " + cid + " longer than " + strconv.Itoa(MaxDelegationDepth))
+		}
+	}
+	return nil
+}
+
+
+// ============================================================================================================================
+// Delegation Depth Above - the longest chain of delegations for a candidate ending at vid, found through the
+// DelegateIndex. It stops once the chain is longer than limit, which is all the caller needs to know.
+// ============================================================================================================================
+func delegation_depth_above(stub shim.ChaincodeStubInterface, eid string, vid string, cid string, limit int) (int, error) {
+	if limit < 0 {
+		return 0, nil
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(DelegateIndex, []string{eid, vid})
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	depth := 0
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		_, keys, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil {
+			return 0, err
+		}
+		delegator, topic := keys[2], keys[3]
+
+		// only the delegation the delegator's tokens for the candidate actually follow counts
+		delegation, found, err := find_delegation(stub, eid, delegator, cid)
+		if err != nil {
+			return 0, err
+		}
+		if !found || delegation.Topic != topic || delegation.Delegate != vid {
+			continue
+		}
+
+		above, err := delegation_depth_above(stub, eid, delegator, cid, limit - 1)
+		if err != nil {
+			return 0, err
+		}
+		if above + 1 > depth {
+			depth = above + 1
+		}
+		if depth > limit {
+			return depth, nil
+		}
+	}
+	return depth, nil
+}
+
+
+// ============================================================================================================================
+// Get Spendable Delegation - the delegation of delegator that vid may spend on a candidate, vid has to end its chain
+// ============================================================================================================================
+func get_spendable_delegation(stub shim.ChaincodeStubInterface, eid string, delegator string, vid string, cid string) (Delegation, error) {
+	owner, err := get_voter(stub, eid, delegator)
+	if err != nil {
+		return Delegation{}, err
+	}
+	if owner.Status == VoterSuspended || owner.Status == VoterRemoved {
+		return Delegation{}, errors.New("The delegator is " + owner.Status + " - " + delegator)
+	}
+
+	delegation, found, err := find_delegation(stub, eid, delegator, cid)
+	if err != nil {
+		return delegation, err
+	}
+	if !found {
+		return delegation, errors.New("Voter " + delegator + " has not delegated tokens for " + cid)
+	}
+	chain, err := follow_delegations(stub, eid, delegator, cid)
+	if err != nil {
+		return delegation, err
+	}
+	if chain[len(chain) - 1] != vid {
+		return delegation, errors.New("The tokens " + delegator + " delegated for " + cid + " are spent by " + chain[len(chain) - 1])
+	}
+	return delegation, nil
+}
+
+
+// ============================================================================================================================
+// Put Delegation - store a delegation along with its delegate index entry
+// ============================================================================================================================
+func put_delegation(stub shim.ChaincodeStubInterface, delegation Delegation) error {
+	key, err := stub.CreateCompositeKey(DelegationObject, []string{delegation.ElectionID, delegation.Delegator, delegation.Topic})
+	if err != nil {
+		return err
+	}
+	delegation.ObjectType = DelegationObject
+	delegationAsBytes, _ := json.Marshal(delegation)
+	err = stub.PutState(key, delegationAsBytes)
+	if err != nil {
+		return err
+	}
+
+	key, err = stub.CreateCompositeKey(DelegateIndex, []string{delegation.ElectionID, delegation.Delegate, delegation.Delegator, delegation.Topic})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte{0x00})
+}
+
+
+// ============================================================================================================================
+// Delete Delegation - remove a delegation and its delegate index entry
+// ============================================================================================================================
+func delete_delegation(stub shim.ChaincodeStubInterface, delegation Delegation) error {
+	key, err := stub.CreateCompositeKey(DelegationObject, []string{delegation.ElectionID, delegation.Delegator, delegation.Topic})
+	if err != nil {
+		return err
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return err
+	}
+
+	key, err = stub.CreateCompositeKey(DelegateIndex, []string{delegation.ElectionID, delegation.Delegate, delegation.Delegator, delegation.Topic})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
+
+// ============================================================================================================================
+// Emit Event - set the event of the transaction. Fabric keeps a single event per transaction, so every state changing
+// function emits exactly one, once everything is written.
+// ============================================================================================================================
+func emit_event(stub shim.ChaincodeStubInterface, eventType string, eid string, data interface{}) error {
+	var event ChaincodeEvent
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return err
+	}
+
+	event.Type = eventType
+	event.Version = EventVersion
+	event.ElectionID = eid
+	event.TxID = stub.GetTxID()
+	event.Timestamp = now
+	event.Data = data
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(eventType, eventAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Allocation - get the votes a voter gave a candidate of a quadratic election, empty when there are none yet
+// ============================================================================================================================
+func get_allocation(stub shim.ChaincodeStubInterface, eid string, vid string, cid string) (Allocation, error) {
+	var allocation Allocation
+	key, err := stub.CreateCompositeKey(AllocationObject, []string{eid, vid, cid})
+	if err != nil {
+		return allocation, err
+	}
+	allocationAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return allocation, errors.New("Failed to find allocation of " + vid + " for " + cid)
+	}
+	if allocationAsBytes == nil {
+		allocation.ElectionID = eid
+		allocation.VID = vid
+		allocation.CID = cid
+		return allocation, nil
+	}
+	err = json.Unmarshal(allocationAsBytes, &allocation)
+	if err != nil {
+		return allocation, errors.New("Failed to decode allocation of " + vid + " for " + cid + " - " + err.Error())
+	}
+	return allocation, nil
+}
+
+
+// ============================================================================================================================
+// Put Allocation - store an allocation into the ledger
+// ============================================================================================================================
+func put_allocation(stub shim.ChaincodeStubInterface, allocation Allocation) error {
+	key, err := stub.CreateCompositeKey(AllocationObject, []string{allocation.ElectionID, allocation.VID, allocation.CID})
+	if err != nil {
+		return err
+	}
+	allocation.ObjectType = AllocationObject
+	allocationAsBytes, _ := json.Marshal(allocation)
+	return stub.PutState(key, allocationAsBytes)
+}
+
+
+// ============================================================================================================================
+// Quadratic Cost - tokens charged for adding votes on top of the current ones, (current+votes)^2 - current^2
+// ============================================================================================================================
+func quadratic_cost(current uint64, votes uint64) (uint64, error) {
+	total, err := add_count(current, votes)
+	if err != nil {
+		return 0, err
+	}
+	// (c+v)^2 - c^2 = v * (2c + v) = v * (c + total)
+	factor, err := add_count(current, total)
+	if err != nil {
+		return 0, err
+	}
+	return mul_count(votes, factor)
+}
+
+
+// ============================================================================================================================
+// Record Receipt - write the receipt of a token purchase made by the current transaction
+// ============================================================================================================================
+func record_receipt(stub shim.ChaincodeStubInterface, voter Voter, tokens uint64) error {
+	var receipt Receipt
+	now, err := get_tx_time(stub)
+	if err != nil {
+		return err
+	}
+	identity, err := get_identity(stub)
+	if err != nil {
+		return err
+	}
+
+	receipt.ObjectType = ReceiptObject
+	receipt.ReceiptID = stub.GetTxID()
+	receipt.ElectionID = voter.ElectionID
+	receipt.VID = voter.VID
+	receipt.Tokens = tokens
+	receipt.TokensBought = voter.TokensBought
+	receipt.BuyerMSPID = identity.MSPID
+	receipt.BuyerID = identity.ID
+	receipt.PurchasedAt = now
+
+	key, err := stub.CreateCompositeKey(ReceiptObject, []string{receipt.ElectionID, receipt.VID, receipt.ReceiptID})
+	if err != nil {
+		return err
+	}
+	receiptAsBytes, _ := json.Marshal(receipt)
+	return stub.PutState(key, receiptAsBytes)
+}
+
+
+// ============================================================================================================================
+// Get Commitment - get one commitment of a voter from ledger
+// ============================================================================================================================
+func get_commitment(stub shim.ChaincodeStubInterface, eid string, vid string, commitID string) (Commitment, error) {
+	var commitment Commitment
+	key, err := stub.CreateCompositeKey(CommitmentObject, []string{eid, vid, commitID})
+	if err != nil {
+		return commitment, err
+	}
+	commitmentAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return commitment, errors.New("Failed to find commitment - " + commitID)
+	}
+	if commitmentAsBytes == nil {
+		return commitment, errors.New("Commitment does not exist - " + commitID)
+	}
+	err = json.Unmarshal(commitmentAsBytes, &commitment)
+	if err != nil {
+		return commitment, errors.New("Failed to decode commitment " + commitID + " - " + err.Error())
+	}
+	return commitment, nil
+}
+
+
+// ============================================================================================================================
+// Get Commitments - range scan the commitments under a partial key, [election] or [election, voter]
+// ============================================================================================================================
+func get_commitments(stub shim.ChaincodeStubInterface, keys []string) ([]Commitment, error) {
+	commitments := []Commitment{}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(CommitmentObject, keys)
+	if err != nil {
+		return commitments, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return commitments, err
+		}
+		var commitment Commitment
+		err = json.Unmarshal(kv.Value, &commitment)
+		if err != nil {
+			return commitments, errors.New("Failed to decode commitment - " + kv.Key)
+		}
+		commitments = append(commitments, commitment)
+	}
+	return commitments, nil
+}
+
+
+// ============================================================================================================================
+// Put Commitment - store a commitment under its election, voter and commit id
+// ============================================================================================================================
+func put_commitment(stub shim.ChaincodeStubInterface, commitment Commitment) error {
+	key, err := stub.CreateCompositeKey(CommitmentObject, []string{commitment.ElectionID, commitment.VID, commitment.CommitID})
+	if err != nil {
+		return err
+	}
+	commitment.ObjectType = CommitmentObject
+	commitmentAsBytes, _ := json.Marshal(commitment)
+	return stub.PutState(key, commitmentAsBytes)
+}
+
+
+// ============================================================================================================================
+// Commitment Hash - hex encoded sha256 of "<candidate id>:<tokens>:<nonce>"
+// ============================================================================================================================
+func commitment_hash(cid string, tokens uint64, nonce string) string {
+	sum := sha256.Sum256([]byte(cid + ":" + strconv.FormatUint(tokens, 10) + ":" + nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+
+// ============================================================================================================================
+// Tally Private Votes - count the private votes of an election into the candidates' public totals. Only a peer holding
+// the PrivateCollection can endorse this, which is why it runs once when the election closes.
+// ============================================================================================================================
+func tally_private_votes(stub shim.ChaincodeStubInterface, election Election) error {
+	totals := map[string]uint64{}
+
+	resultsIterator, err := stub.GetPrivateDataByPartialCompositeKey(PrivateCollection, PrivateVoteObject, []string{election.EID})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		var privateVote PrivateVote
+		err = json.Unmarshal(kv.Value, &privateVote)
+		if err != nil {
+			return errors.New("Failed to decode private vote " + kv.Key + " - " + err.Error())
+		}
+		totals[privateVote.CID], err = add_count(totals[privateVote.CID], privateVote.Tokens)
+		if err != nil {
+			return err
+		}
+	}
+
+	candidates, err := get_all_candidates(stub, election.EID)
+	if err != nil {
+		return err
+	}
+	for _, candidate := range candidates {
+		candidate.VotesReceived = totals[candidate.CID]
+		err = put_candidate(stub, candidate)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Candidate " + candidate.CID + " got " + strconv.FormatUint(candidate.VotesReceived, 10) + " private votes")
+	}
+	return nil
+}
+
+
+// ============================================================================================================================
+// Settle Commitments - apply the election's unrevealed policy to every commitment still sealed at finalization
+// ============================================================================================================================
+func settle_commitments(stub shim.ChaincodeStubInterface, election Election, now string) error {
+	refunds := map[string]uint64{}
+	var refunded []string
+
+	commitments, err := get_commitments(stub, []string{election.EID})
+	if err != nil {
+		return err
+	}
+
+	for _, commitment := range commitments {
+		if commitment.Status != CommitmentSealed {
+			continue
+		}
+		if election.UnrevealedPolicy == UnrevealedForfeit {
+			commitment.Status = CommitmentForfeited
+		} else {
+			commitment.Status = CommitmentRefunded
+			if _, seen := refunds[commitment.VID]; !seen {
+				refunded = append(refunded, commitment.VID)
+			}
+			refunds[commitment.VID], err = add_count(refunds[commitment.VID], commitment.Tokens)
+			if err != nil {
+				return err
+			}
+		}
+		commitment.SettledAt = now
+		err = put_commitment(stub, commitment)
+		if err != nil {
+			return err
+		}
+	}
+
+	// a voter can hold several commitments, give every voter back the sum in one write
+	for _, vid := range refunded {
+		voter, err := get_voter(stub, election.EID, vid)
+		if err != nil {
+			return err
+		}
+		voter.TokensRemaining, err = add_count(voter.TokensRemaining, refunds[vid])
+		if err != nil {
+			return err
+		}
+		sync_voter_status(&voter, now)
+		err = put_voter(stub, voter)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Refunded " + strconv.FormatUint(refunds[vid], 10) + " unrevealed tokens to " + vid)
+	}
+	return nil
+}
+
+
+// ============================================================================================================================
+// Refund Candidate - revoke every ballot of a candidate and give the tokens back, to the delegator for delegated
+// ballots. Quadratic voters get back what their allocation for the candidate cost.
+// ============================================================================================================================
+func refund_candidate(stub shim.ChaincodeStubInterface, election Election, cid string, now string) error {
+	refunds := map[string]uint64{}
+	var refunded []string
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(CandidateBallotIndex, []string{election.EID, cid})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		_, keys, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil {
+			return err
+		}
+		ballot, err := get_ballot(stub, election.EID, keys[2])
+		if err != nil {
+			return err
+		}
+		if ballot.Revoked {
+			continue
+		}
+
+		payer := ballot.VID
+		if ballot.Delegator != "" {
+			payer = ballot.Delegator
+		}
+		if _, seen := refunds[payer]; !seen {
+			refunded = append(refunded, payer)
+			refunds[payer] = 0
+		}
+		if election.VoteCost != VoteCostQuadratic {
+			refunds[payer], err = add_count(refunds[payer], ballot.Tokens)
+			if err != nil {
+				return err
+			}
+		}
+
+		ballot.Revoked = true
+		ballot.RevokedAt = now
+		ballot.RevokedBy = stub.GetTxID()
+		err = put_ballot(stub, ballot)
+		if err != nil {
+			return err
+		}
+	}
+
+	// a voter can hold several ballots, give every voter back the sum in one write
+	for _, vid := range refunded {
+		if election.VoteCost == VoteCostQuadratic {
+			allocation, err := get_allocation(stub, election.EID, vid, cid)
+			if err != nil {
+				return err
+			}
+			refunds[vid] = allocation.TokensSpent
+			allocation.Votes = 0
+			allocation.TokensSpent = 0
+			err = put_allocation(stub, allocation)
+			if err != nil {
+				return err
+			}
+		}
+		voter, err := get_voter(stub, election.EID, vid)
+		if err != nil {
+			return err
+		}
+		voter.TokensRemaining, err = add_count(voter.TokensRemaining, refunds[vid])
+		if err != nil {
+			return err
+		}
+		sync_voter_status(&voter, now)
+		err = put_voter(stub, voter)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Refunded " + strconv.FormatUint(refunds[vid], 10) + " tokens of withdrawn candidate " + cid + " to " + vid)
+	}
+	return nil
+}
+
+
+// ============================================================================================================================
+// Max Tokens - the most tokens a voter can buy in an election, elections stored before the cap was mandatory get the
+// default
+// ============================================================================================================================
+func max_tokens(election Election) uint64 {
+	if election.MaxTokens == 0 {
+		return DefaultMaxTokens
+	}
+	return election.MaxTokens
+}
+
+
+// ============================================================================================================================
+// Get Running Candidate - get a candidate that can still receive votes
+// ============================================================================================================================
+func get_running_candidate(stub shim.ChaincodeStubInterface, eid string, cid string) (Candidate, error) {
+	candidate, err := get_candidate(stub, eid, cid)
+	if err != nil {
+		return candidate, err
+	}
+	if candidate.Status == CandidateWithdrawn {
+		return candidate, errors.New("This candidate has withdrawn - " + cid)
+	}
+	return candidate, nil
+}
+
+
+// ============================================================================================================================
+// Parse Election Options - apply "name=value" options to a new election
+// ============================================================================================================================
+func parse_election_options(election *Election, options []string) error {
+	for _, option := range options {
+		pair := strings.SplitN(option, "=", 2)
+		if len(pair) != 2 {
+			return errors.New("Options must look like name=value - " + option)
+		}
+		name, value := pair[0], pair[1]
+
+		switch name {
+		case "mode":
+			if value != BallotPublic && value != BallotCommitReveal && value != BallotPrivate {
+				return errors.New("Unknown ballot mode - " + value)
+			}
+			election.BallotMode = value
+		case "revocation":
+			allow, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.New("Expecting true or false for revocation - " + value)
+			}
+			election.AllowRevocation = allow
+		case "max_tokens":
+			maxTokens, err := parse_count(value)
+			if err != nil || maxTokens == 0 {
+				return errors.New("Expecting a positive max_tokens - " + value)
+			}
+			election.MaxTokens = maxTokens
+		case "vote_cost":
+			if value != VoteCostLinear && value != VoteCostQuadratic {
+				return errors.New("Unknown vote cost - " + value)
+			}
+			election.VoteCost = value
+		case "method":
+			if _, found := ballotTypes[value]; !found {
+				return errors.New("Unknown voting method - " + value)
+			}
+			election.Method = value
+		case "seats":
+			seats, err := parse_count(value)
+			if err != nil || seats == 0 {
+				return errors.New("Expecting a positive number of seats - " + value)
+			}
+			election.Seats = seats
+		case "quota":
+			if value != QuotaDroop && value != QuotaHare {
+				return errors.New("Unknown quota - " + value)
+			}
+			election.Quota = value
+		case "withdrawal":
+			if value != WithdrawalRefund && value != WithdrawalFreeze && value != WithdrawalBlock {
+				return errors.New("Unknown withdrawal policy - " + value)
+			}
+			election.Withdrawal = value
+		case "unrevealed":
+			if value != UnrevealedRefund && value != UnrevealedForfeit {
+				return errors.New("Unknown unrevealed policy - " + value)
+			}
+			election.UnrevealedPolicy = value
+		default:
+			return errors.New("Unknown election option - " + name)
+		}
+	}
+
+	if election.BallotMode == BallotCommitReveal && election.UnrevealedPolicy == "" {
+		election.UnrevealedPolicy = UnrevealedRefund
+	}
+	if election.BallotMode != BallotCommitReveal && election.UnrevealedPolicy != "" {
+		return errors.New("The unrevealed option only applies to commit_reveal elections")
+	}
+	if election.BallotMode != BallotPublic && election.AllowRevocation {
+		return errors.New("The revocation option only applies to public elections")
+	}
+	if election.BallotMode == BallotPrivate && election.Withdrawal == WithdrawalRefund {
+		return errors.New("Private ballots cannot be refunded, use withdrawal=freeze or block")
+	}
+	// a sealed vote for a candidate that withdrew could never be revealed and would be lost at finalization
+	if election.BallotMode == BallotCommitReveal && election.Withdrawal != WithdrawalBlock {
+		return errors.New("Sealed ballots only support withdrawal=block")
+	}
+	if election.BallotMode != BallotPublic && election.VoteCost == VoteCostQuadratic {
+		return errors.New("Quadratic vote cost only applies to public elections")
+	}
+	if election.Method == MethodSTV {
+		if election.Seats == 0 {
+			election.Seats = 1
+		}
+		if election.Quota == "" {
+			election.Quota = QuotaDroop
+		}
+	} else if election.Seats != 0 || election.Quota != "" {
+		return errors.New("The seats and quota options only apply to stv elections")
+	}
+	if election.Method != MethodTokens && (election.BallotMode != BallotPublic || election.VoteCost == VoteCostQuadratic || election.AllowRevocation) {
+		return errors.New("Elections that do not transfer tokens are public, linear and do not allow revocation")
+	}
+	return nil
+}
+
+
+// ============================================================================================================================
+// Is Ranked - whether voters of the election cast ranked ballots
+// ============================================================================================================================
+func is_ranked(election Election) bool {
+	return election.Method == MethodIRV || election.Method == MethodSTV
+}
+
+
+// ============================================================================================================================
+// Election Method - the voting method of an election, elections created before methods existed transfer tokens
+// ============================================================================================================================
+func election_method(election Election) string {
+	if election.Method == "" {
+		return MethodTokens
+	}
+	return election.Method
+}
+
+// ============================================================================================================================
+// Get Election - get an election asset from ledger
+// ============================================================================================================================
+func get_election(stub shim.ChaincodeStubInterface, eid string) (Election, error) {
+	var election Election
+	key, err := election_key(stub, eid)
+	if err != nil {
+		return election, err
+	}
+	electionAsBytes, err := stub.GetState(key)
+
+	if err != nil {
+		return election, errors.New("Failed to find election - " + eid)
+	}
+	if electionAsBytes == nil {
+		return election, notFoundError("Election does not exist - " + eid)
+	}
+	err = json.Unmarshal(electionAsBytes, &election)
+	if err != nil {
+		return election, errors.New("Failed to decode election " + eid + " - " + err.Error())
+	}
+
+	if election.ObjectType != ElectionObject || election.EID != eid {
+		return election, errors.New("Election stored under the wrong key - " + eid)
+	}
+
+	return election, nil
+}
+
+
+// ============================================================================================================================
+// Put Election - store an election asset into the ledger
+// ============================================================================================================================
+func put_election(stub shim.ChaincodeStubInterface, election Election) error {
+	key, err := election_key(stub, election.EID)
+	if err != nil {
+		return err
+	}
+	election.ObjectType = ElectionObject
+	electionAsBytes, _ := json.Marshal(election)
+	return stub.PutState(key, electionAsBytes)
+}
+
+
+// ============================================================================================================================
+// Check Election Status - get an election and make sure it is in one of the allowed statuses
+// ============================================================================================================================
+func check_election_status(stub shim.ChaincodeStubInterface, eid string, allowed ...string) (Election, error) {
+	election, err := get_election(stub, eid)
+	if err != nil {
+		return election, err
+	}
+
+	for _, status := range allowed {
+		if election.Status == status {
+			return election, nil
+		}
+	}
+
+	return election, errors.New("Election '" + eid + "' is " + election.Status + ", expected " + strings.Join(allowed, " or "))
+}
+
+
+// ============================================================================================================================
+// Get Tx Time - the transaction timestamp as an RFC3339 string, the same on every endorsing peer
+// ============================================================================================================================
+func get_tx_time(stub shim.ChaincodeStubInterface) (string, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return "", errors.New("Failed to get transaction timestamp")
+	}
+	return format_timestamp(ts.Seconds, ts.Nanos), nil
+}
+
+
+// ============================================================================================================================
+// Format Timestamp - a ledger timestamp as an RFC3339 UTC string
+// ============================================================================================================================
+func format_timestamp(seconds int64, nanos int32) string {
+	return time.Unix(seconds, int64(nanos)).UTC().Format(time.RFC3339)
+}
+
+
+// ============================================================================================================================
+// Set Voter Status - move a voter to another status if voterTransitions allows it
+// ============================================================================================================================
+func set_voter_status(voter *Voter, to string, reason string, now string) error {
+	for _, allowed := range voterTransitions[voter.Status] {
+		if allowed == to {
+			fmt.Println("The voter '" + voter.VID + "' goes from " + voter.Status + " to " + to + " (" + reason + ")")
+			voter.Status = to
+			voter.StatusReason = reason
+			voter.StatusChangedAt = now
+			return nil
+		}
+	}
+	return errors.New("A voter can not go from " + voter.Status + " to " + to + " - " + voter.VID)
+}
+
+
+// ============================================================================================================================
+// Check Admin Reason - make sure an admin gave one of the adminReasons for a voter status change
+// ============================================================================================================================
+func check_admin_reason(reason string) error {
+	for _, code := range adminReasons {
+		if code == reason {
+			return nil
+		}
+	}
+	return errors.New("Unknown reason code '" + reason + "', expected one of " + strings.Join(adminReasons, ", "))
+}
+
+
+// ============================================================================================================================
+// Sync Voter Status - after the token balance changed, an active voter with no tokens left is exhausted and an
+// exhausted voter that got tokens back is active. Suspended and removed voters are left alone.
+// ============================================================================================================================
+func sync_voter_status(voter *Voter, now string) {
+	if voter.Status == VoterActive && voter.TokensRemaining == 0 {
+		set_voter_status(voter, VoterExhausted, ReasonTokensSpent, now)
+	} else if voter.Status == VoterExhausted && voter.TokensRemaining > 0 {
+		set_voter_status(voter, VoterActive, ReasonTokensReturned, now)
+	}
+}
+
+
+// ============================================================================================================================
+// Parse Count - parse a token or vote count argument, only plain unsigned numbers are accepted
+// ============================================================================================================================
+func parse_count(str string) (uint64, error) {
+	count, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, errors.New("Expecting an unsigned number - " + str)
+	}
+	return count, nil
+}
+
+
+// ============================================================================================================================
+// Decode Count - decode a stored count, either a JSON number or the quoted string older versions wrote
+// ============================================================================================================================
+func decode_count(field string, raw json.RawMessage) (uint64, error) {
+	if len(raw) == 0 {
+		return 0, errors.New(field + " is missing")
+	}
+	str := string(raw)
+	if raw[0] == '"' {
+		err := json.Unmarshal(raw, &str)
+		if err != nil {
+			return 0, errors.New(field + " is not a valid count - " + string(raw))
+		}
+	}
+	count, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, errors.New(field + " is not a valid count - " + string(raw))
+	}
+	return count, nil
+}
+
+
+// ============================================================================================================================
+// Add Count / Sub Count / Mul Count - overflow and underflow checked arithmetic on counts
+// ============================================================================================================================
+func add_count(a uint64, b uint64) (uint64, error) {
+	if a + b < a {
+		return 0, errors.New("Count overflow adding " + strconv.FormatUint(b, 10) + " to " + strconv.FormatUint(a, 10))
+	}
+	return a + b, nil
+}
+
+func sub_count(a uint64, b uint64) (uint64, error) {
+	if b > a {
+		return 0, errors.New("Count underflow subtracting " + strconv.FormatUint(b, 10) + " from " + strconv.FormatUint(a, 10))
+	}
+	return a - b, nil
+}
+
+func mul_count(a uint64, b uint64) (uint64, error) {
+	if a != 0 && (a * b) / a != b {
+		return 0, errors.New("Count overflow multiplying " + strconv.FormatUint(a, 10) + " by " + strconv.FormatUint(b, 10))
+	}
+	return a * b, nil
+}
+
+
+// ============================================================================================================================
+// Get Role MSPs - the MSPs trusted for each role, as stored by Init or else defaultRoleMSPs
+// ============================================================================================================================
+func get_role_msps(stub shim.ChaincodeStubInterface) (map[string][]string, error) {
+	roleMSPs := map[string][]string{}
+	roleMSPsAsBytes, err := stub.GetState(RoleMSPsKey)
+	if err != nil {
+		return nil, errors.New("Failed to get the trusted MSPs - " + err.Error())
+	}
+	if roleMSPsAsBytes == nil {
+		for role, mspids := range defaultRoleMSPs {
+			roleMSPs[role] = mspids
+		}
+		return roleMSPs, nil
+	}
+	err = json.Unmarshal(roleMSPsAsBytes, &roleMSPs)
+	if err != nil {
+		return nil, errors.New("Failed to decode the trusted MSPs - " + err.Error())
+	}
+	return roleMSPs, nil
+}
+
+
+// ============================================================================================================================
+// Parse Role MSPs - apply "role=MSP,MSP" arguments of Init to the MSPs trusted for each role
+// ============================================================================================================================
+func parse_role_msps(roleMSPs map[string][]string, options []string) error {
+	for _, option := range options {
+		pair := strings.SplitN(option, "=", 2)
+		if len(pair) != 2 {
+			return errors.New("Trusted MSPs must look like role=MSP,MSP - " + option)
+		}
+		role := pair[0]
+		if _, exists := defaultRoleMSPs[role]; !exists {
+			return errors.New("Unknown role - " + role)
+		}
+		mspids := strings.Split(pair[1], ",")
+		for _, mspid := range mspids {
+			if mspid == "" {
+				return errors.New("Expecting a comma separated list of MSP IDs for " + role + " - " + pair[1])
+			}
+		}
+		roleMSPs[role] = mspids
+	}
+	return nil
+}
+
+
+// ============================================================================================================================
+// Get Identity - MSP ID, unique id and role of the transaction submitter, the role is empty unless the MSPs trusted
+// for it (get_role_msps) include the submitter's
+// ============================================================================================================================
+func get_identity(stub shim.ChaincodeStubInterface) (Identity, error) {
+	var identity Identity
+	var err error
+
+	identity.MSPID, err = cid.GetMSPID(stub)
+	if err != nil {
+		return identity, errors.New("Failed to get the caller's MSP ID - " + err.Error())
+	}
+	identity.ID, err = cid.GetID(stub)
+	if err != nil {
+		return identity, errors.New("Failed to get the caller's ID - " + err.Error())
+	}
+	role, found, err := cid.GetAttributeValue(stub, RoleAttribute)
+	if err != nil {
+		return identity, errors.New("Failed to get the caller's role - " + err.Error())
+	}
+	// the role only counts when the caller's organization is trusted to grant it
+	if found {
+		roleMSPs, err := get_role_msps(stub)
+		if err != nil {
+			return identity, err
+		}
+		for _, mspid := range roleMSPs[role] {
+			if mspid == identity.MSPID {
+				identity.Role = role
+			}
+		}
+		if identity.Role == "" {
+			fmt.Println("Ignoring role '" + role + "' of an " + identity.MSPID + " caller, that MSP is not trusted for it")
+		}
+	}
+	return identity, nil
+}
+
+
+// ============================================================================================================================
+// Check Tombstone Access - removed voters are kept for the audit trail and only auditors can read them
+// ============================================================================================================================
+func check_tombstone_access(stub shim.ChaincodeStubInterface, voter Voter) error {
+	if voter.Status != VoterRemoved {
+		return nil
+	}
+	identity, err := get_identity(stub)
+	if err != nil {
+		return err
+	}
+	if identity.Role != RoleAuditor {
+		return errors.New("This voter has been removed - " + voter.VID)
+	}
+	return nil
+}
 
 
 // ============================================================================================================================
-// Disable Voter
+// Check Voter Visible - for queries about a voter's records, refuse them for a removed voter unless the caller is an
+// auditor. A voter that was never registered has no records to hide.
 // ============================================================================================================================
-func disable_voter(stub shim.ChaincodeStubInterface, args []string) (Voter, error){
+func check_voter_visible(stub shim.ChaincodeStubInterface, eid string, vid string) error {
+	key, err := voter_key(stub, eid, vid)
+	if err != nil {
+		return err
+	}
+	voterAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return errors.New("Failed to find voter - " + vid)
+	}
+	if voterAsBytes == nil {
+		return nil
+	}
 	var voter Voter
-	fmt.Println("starting disable_voter")
+	err = json.Unmarshal(voterAsBytes, &voter)
+	if err != nil {
+		return errors.New("Failed to decode voter " + vid + " - " + err.Error())
+	}
+	return check_tombstone_access(stub, voter)
+}
 
-	var vid = args[0]
-	
-	//if the voter doesn't have tokens, he must be disabled
-	tR,_ := strconv.Atoi(voter.TokensRemaining)
-	if tR <= 0 {
-		fmt.Println(" Voter - " + vid + " - is gonna be disabled because of not remaining tokens")
-		voter.Enabled = false
-		voter.TokensRemaining = strconv.Itoa(tR)
-		fmt.Println("- end disable_voter")
-		return voter, nil
-	}
-
-	fmt.Println("The voter '" + vid + "' has '" + voter.TokensRemaining + "' remaining tokens")
-	return voter,errors.New("The voter '" + vid + "' has " + voter.TokensRemaining + " remaining tokens")
+
+// ============================================================================================================================
+// Check Voter Owner - make sure the caller is the identity that claimed the voter
+// ============================================================================================================================
+func check_voter_owner(stub shim.ChaincodeStubInterface, voter Voter) error {
+	if voter.OwnerID == "" {
+		return errors.New("This voter has not been claimed yet - " + voter.VID)
+	}
+
+	identity, err := get_identity(stub)
+	if err != nil {
+		return err
+	}
+	if identity.MSPID != voter.OwnerMSPID || identity.ID != voter.OwnerID {
+		return errors.New("The caller does not own voter - " + voter.VID)
+	}
+	return nil
+}
+
+
+// ============================================================================================================================
+// Check Access - look the function up in the access control table and make sure the caller holds an allowed role
+// ============================================================================================================================
+func check_access(stub shim.ChaincodeStubInterface, function string) (Identity, error) {
+	allowed, exists := accessControl[function]
+	if !exists {
+		return Identity{}, errors.New("Received unknown invoke function name - '" + function + "'")
+	}
+
+	identity, err := get_identity(stub)
+	if err != nil {
+		return identity, err
+	}
+
+	for _, role := range allowed {
+		if identity.Role == role {
+			return identity, nil
+		}
+	}
+
+	return identity, errors.New("Access denied - " + identity.MSPID + " caller with role '" + identity.Role + "' may not call " + function)
 }
 
 
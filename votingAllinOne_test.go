@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// ============================================================================================================================
+// Counts - stored counts are JSON numbers now, older versions wrote quoted strings
+// ============================================================================================================================
+func TestDecodeCount(t *testing.T) {
+	cases := []struct {
+		raw   string
+		count uint64
+		fails bool
+	}{
+		{raw: `100`, count: 100},
+		{raw: `"100"`, count: 100},
+		{raw: `0`, count: 0},
+		{raw: `"18446744073709551615"`, count: 18446744073709551615},
+		{raw: ``, fails: true},
+		{raw: `"abc"`, fails: true},
+		{raw: `""`, fails: true},
+		{raw: `-5`, fails: true},
+		{raw: `"-5"`, fails: true},
+		{raw: `1.5`, fails: true},
+		{raw: `18446744073709551616`, fails: true},
+		{raw: `null`, fails: true},
+	}
+	for _, c := range cases {
+		count, err := decode_count("TokensBought", json.RawMessage(c.raw))
+		if c.fails {
+			if err == nil {
+				t.Errorf("decode_count(%s) = %d, expected an error", c.raw, count)
+			}
+			continue
+		}
+		if err != nil || count != c.count {
+			t.Errorf("decode_count(%s) = %d, %v, expected %d", c.raw, count, err, c.count)
+		}
+	}
+}
+
+func TestVoterUnmarshalOldRecords(t *testing.T) {
+	cases := []struct {
+		stored    string
+		bought    uint64
+		remaining uint64
+		status    string
+		reason    string
+	}{
+		// string counts and the Enabled flag from before voter statuses
+		{`{"VID":"v1","TokensBought":"100","TokensRemaining":"80","Enabled":true}`, 100, 80, VoterActive, ReasonRegistered},
+		{`{"VID":"v1","TokensBought":"100","TokensRemaining":"0","Enabled":false}`, 100, 0, VoterExhausted, ReasonTokensSpent},
+		// numeric counts with a status
+		{`{"VID":"v1","TokensBought":50,"TokensRemaining":20,"Status":"suspended","StatusReason":"fraud"}`, 50, 20, VoterSuspended, ReasonFraud},
+		// a stored status wins over a leftover Enabled flag
+		{`{"VID":"v1","TokensBought":50,"TokensRemaining":0,"Status":"removed","StatusReason":"duplicate","Enabled":true}`, 50, 0, VoterRemoved, ReasonDuplicate},
+	}
+	for _, c := range cases {
+		var voter Voter
+		err := json.Unmarshal([]byte(c.stored), &voter)
+		if err != nil {
+			t.Errorf("%s: %v", c.stored, err)
+			continue
+		}
+		if voter.TokensBought != c.bought || voter.TokensRemaining != c.remaining || voter.Status != c.status || voter.StatusReason != c.reason {
+			t.Errorf("%s: got %+v", c.stored, voter)
+		}
+	}
+}
+
+func TestVoterUnmarshalRefusesBadRecords(t *testing.T) {
+	for _, stored := range []string{
+		`{"VID":"v1","TokensBought":"100","TokensRemaining":"80"}`,                 // neither Status nor Enabled
+		`{"VID":"v1","TokensBought":"x","TokensRemaining":"80","Enabled":true}`,    // not a count
+		`{"VID":"v1","TokensBought":100,"Enabled":true}`,                           // count missing
+		`{"VID":"v1","TokensBought":100,"TokensRemaining":-1,"Status":"active"}`,   // negative
+		`{"VID":"v1","TokensBought":100,"TokensRemaining":80,"Status":"sleeping"}`, // unknown status
+	} {
+		var voter Voter
+		if err := json.Unmarshal([]byte(stored), &voter); err == nil {
+			t.Errorf("%s: expected an error, got %+v", stored, voter)
+		}
+	}
+}
+
+// ============================================================================================================================
+// Instant Runoff - known answers for run_irv
+// ============================================================================================================================
+func TestRunIRVMajorityAfterElimination(t *testing.T) {
+	rankings := [][]string{{"a"}, {"a"}, {"b"}, {"b"}, {"c", "b"}}
+	rounds, winner := run_irv([]string{"a", "b", "c"}, rankings)
+	if winner != "b" || len(rounds) != 2 {
+		t.Fatalf("got %s after %+v", winner, rounds)
+	}
+	if rounds[0].Eliminated != "c" || rounds[0].TieBreak || rounds[0].Elected != "" {
+		t.Errorf("round 1: %+v", rounds[0])
+	}
+	if rounds[1].Elected != "b" || rounds[1].Tallies[0] != (RoundTally{CID: "b", Votes: 3}) {
+		t.Errorf("round 2: %+v", rounds[1])
+	}
+}
+
+func TestRunIRVTieForLastPlace(t *testing.T) {
+	rankings := [][]string{{"a"}, {"a"}, {"a"}, {"b"}, {"b"}, {"c"}, {"d", "c"}}
+	rounds, winner := run_irv([]string{"a", "b", "c", "d"}, rankings)
+	if winner != "a" || len(rounds) != 3 {
+		t.Fatalf("got %s after %+v", winner, rounds)
+	}
+	// c and d share one first preference each, d sorts last
+	if rounds[0].Eliminated != "d" || !rounds[0].TieBreak {
+		t.Errorf("round 1: %+v", rounds[0])
+	}
+	// b and c both hold 2 votes, c had fewer first preferences
+	if rounds[1].Eliminated != "c" || !rounds[1].TieBreak {
+		t.Errorf("round 2: %+v", rounds[1])
+	}
+	if rounds[2].Elected != "a" || rounds[2].Exhausted != 2 {
+		t.Errorf("round 3: %+v", rounds[2])
+	}
+}
+
+func TestRunIRVAllBallotsExhausted(t *testing.T) {
+	rounds, winner := run_irv([]string{"a", "b"}, [][]string{{"x"}, {"y", "z"}})
+	if winner != "" || len(rounds) != 1 || rounds[0].Exhausted != 2 || rounds[0].Elected != "" {
+		t.Fatalf("got %q after %+v", winner, rounds)
+	}
+
+	rounds, winner = run_irv([]string{"a", "b"}, [][]string{})
+	if winner != "" || len(rounds) != 1 || rounds[0].Exhausted != 0 {
+		t.Fatalf("got %q after %+v", winner, rounds)
+	}
+}
+
+// ============================================================================================================================
+// Single Transferable Vote - known answers for stv_quota, run_stv and pick_eliminated
+// ============================================================================================================================
+func TestSTVQuota(t *testing.T) {
+	cases := []struct {
+		ballots uint64
+		seats   uint64
+		method  string
+		quota   uint64
+	}{
+		{10, 2, QuotaDroop, 4 * STVScale},
+		{100, 1, QuotaDroop, 51 * STVScale},
+		{7, 3, QuotaDroop, 2 * STVScale},
+		{10, 2, QuotaHare, 5 * STVScale},
+		{7, 3, QuotaHare, 233333},
+	}
+	for _, c := range cases {
+		quota, err := stv_quota(c.ballots, c.seats, c.method)
+		if err != nil || quota != c.quota {
+			t.Errorf("stv_quota(%d, %d, %s) = %d, %v, expected %d", c.ballots, c.seats, c.method, quota, err, c.quota)
+		}
+	}
+}
+
+func TestRunSTVSurplusTransfer(t *testing.T) {
+	rankings := [][]string{}
+	for i := 0; i < 6; i++ {
+		rankings = append(rankings, []string{"a", "b"})
+	}
+	rankings = append(rankings, []string{"b"}, []string{"b"}, []string{"c"}, []string{"c"})
+	rounds, elected, err := run_stv([]string{"a", "b", "c"}, rankings, 2, 4*STVScale)
+	if err != nil || len(rounds) != 3 || len(elected) != 2 || elected[0] != "a" || elected[1] != "b" {
+		t.Fatalf("got %v, %v after %+v", elected, err, rounds)
+	}
+	if rounds[0].Elected[0] != "a" || rounds[0].Surplus != 2*STVScale {
+		t.Errorf("round 1: %+v", rounds[0])
+	}
+	// each of a's six ballots moves on at 100000 * 200000 / 600000 = 33333, rounded down
+	if rounds[1].Tallies[0] != (RoundTally{CID: "b", Votes: 2*STVScale + 6*33333}) || rounds[1].Eliminated != "c" || rounds[1].TieBreak {
+		t.Errorf("round 2: %+v", rounds[1])
+	}
+	if rounds[2].Elected[0] != "b" || rounds[2].Exhausted != 2*STVScale {
+		t.Errorf("round 3: %+v", rounds[2])
+	}
+}
+
+func TestRunSTVTieForLastPlace(t *testing.T) {
+	rankings := [][]string{{"a"}, {"a"}, {"b", "a"}, {"c"}}
+	rounds, elected, err := run_stv([]string{"a", "b", "c"}, rankings, 1, 3*STVScale)
+	if err != nil || len(rounds) != 3 || len(elected) != 1 || elected[0] != "a" {
+		t.Fatalf("got %v, %v after %+v", elected, err, rounds)
+	}
+	// b and c share one first preference each, c sorts last
+	if rounds[0].Eliminated != "c" || !rounds[0].TieBreak {
+		t.Errorf("round 1: %+v", rounds[0])
+	}
+	if rounds[1].Eliminated != "b" || rounds[1].TieBreak || rounds[1].Exhausted != STVScale {
+		t.Errorf("round 2: %+v", rounds[1])
+	}
+	if rounds[2].Tallies[0] != (RoundTally{CID: "a", Votes: 3 * STVScale}) {
+		t.Errorf("round 3: %+v", rounds[2])
+	}
+}
+
+func TestRunSTVNoBallots(t *testing.T) {
+	rounds, elected, err := run_stv([]string{"a", "b"}, [][]string{}, 1, STVScale)
+	if err != nil || len(rounds) != 0 || len(elected) != 0 {
+		t.Fatalf("got %v, %v after %+v", elected, err, rounds)
+	}
+}
+
+func TestPickEliminated(t *testing.T) {
+	tallies := []RoundTally{{CID: "a", Votes: 3}, {CID: "b", Votes: 1}, {CID: "c", Votes: 1}}
+	cases := []struct {
+		firstPreferences map[string]uint64
+		eliminated       string
+	}{
+		{map[string]uint64{"b": 2, "c": 1}, "c"},
+		{map[string]uint64{"b": 1, "c": 2}, "b"},
+		{map[string]uint64{"b": 1, "c": 1}, "c"},
+	}
+	for _, c := range cases {
+		eliminated, tieBreak := pick_eliminated(tallies, c.firstPreferences)
+		if eliminated != c.eliminated || !tieBreak {
+			t.Errorf("first preferences %v: got %s, %v", c.firstPreferences, eliminated, tieBreak)
+		}
+	}
+	eliminated, tieBreak := pick_eliminated(tallies[:2], map[string]uint64{})
+	if eliminated != "b" || tieBreak {
+		t.Errorf("no tie: got %s, %v", eliminated, tieBreak)
+	}
+}